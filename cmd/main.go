@@ -1,50 +1,182 @@
 package main
 
 import (
+	"context"
 	"log"
-	"strings"
+	"net/http"
+	"os"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/k0kubun/pp"
 	tgbot "github.com/rarebek/supervisor-tg-notifier/pkg/bot"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/eventlistener"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/state"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
 )
 
 func main() {
-	serverURLs := strings.Split(config.ServerURLs, ",")
-	supervisorClients := make(map[string]*supervisor.Client)
+	if config.Mode == "eventlistener" {
+		runEventListener()
+		return
+	}
 
-	for _, url := range serverURLs {
-		auth := &supervisor.BasicAuth{
-			Username: config.SupervisorUsername,
-			Password: config.SupervisorPassword,
-		}
+	supervisorClients := newSupervisorClients()
+	for _, client := range supervisorClients {
+		defer client.Close()
+	}
+
+	handler := newHandler(supervisorClients, newStore())
+
+	ctx := context.Background()
+	handler.RestoreState(ctx)
+	handler.ShowAllProcesses(ctx, config.TelegramChatID, nil)
 
-		client, err := supervisor.NewClient(url, auth)
+	// Events from remote listeners are handled on this goroutine, like polling
+	events := make(chan eventlistener.Event, 100)
+	if config.EventsListenAddr != "" {
+		receiver, err := eventlistener.NewReceiver(config.EventsToken, func(event eventlistener.Event) {
+			events <- event
+		})
 		if err != nil {
-			log.Fatalf("Error creating supervisor client for %s: %v", url, err)
+			log.Fatalf("Error setting up EVENTS_LISTEN_ADDR: %v, set EVENTS_TOKEN", err)
 		}
-		defer client.Close()
-		supervisorClients[url] = client
+		go func() {
+			log.Printf("Listening for events on %s", config.EventsListenAddr)
+			log.Fatal(http.ListenAndServe(config.EventsListenAddr, receiver))
+		}()
 	}
 
-	bot, err := tgbotapi.NewBotAPI(config.TelegramBotToken)
-	if err != nil {
-		log.Fatalf("Error creating Telegram bot: %v", err)
+	// A zero interval disables polling when every server sends events
+	var tick <-chan time.Time
+	if config.PollInterval > 0 {
+		ticker := time.NewTicker(config.PollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
 	}
-	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	handler := tgbot.NewHandler(bot, supervisorClients)
+	handler.RegisterCommands()
+	go handler.HandleUpdates()
+
+	for {
+		select {
+		case <-tick:
+			handler.CheckProcessStatuses(ctx)
+		case event := <-events:
+			handler.HandleEvent(ctx, event)
+		}
+	}
+}
 
-	handler.ShowAllProcesses(config.TelegramChatID)
+// runEventListener runs as a supervisord [eventlistener:x] program, either
+// forwarding events to a central bot or acting as the bot on this host
+func runEventListener() {
+	// stdout carries the listener protocol, everything else must go to stderr
+	protocolOut := os.Stdout
+	os.Stdout = os.Stderr
+	log.SetOutput(os.Stderr)
+	pp.SetDefaultOutput(os.Stderr)
 
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	serverURL := eventsServerURL()
 
-	go handler.HandleUpdates()
+	var handle eventlistener.Handler
+	if config.EventsForwardURL != "" {
+		if config.EventsToken == "" {
+			log.Fatalf("EVENTS_FORWARD_URL needs EVENTS_TOKEN, the bot refuses events without it")
+		}
+		handle = eventlistener.NewForwarder(config.EventsForwardURL, config.EventsToken).Forward
+	} else {
+		// Standalone, this process is the only bot. It answers the buttons of
+		// its alerts and keeps mutes and subscriptions in STATE_FILE itself.
+		supervisorClients := newSupervisorClients()
+		for _, client := range supervisorClients {
+			defer client.Close()
+		}
+		handler := newHandler(supervisorClients, newStore())
+
+		ctx := context.Background()
+		handler.RestoreState(ctx)
+		handler.RegisterCommands()
+		go handler.HandleUpdates()
+
+		handle = func(event eventlistener.Event) error {
+			handler.HandleEvent(ctx, event)
+			return nil
+		}
+	}
 
-	for range ticker.C {
-		handler.CheckProcessStatuses()
+	if err := eventlistener.Run(os.Stdin, protocolOut, serverURL, handle); err != nil {
+		log.Fatalf("Event listener stopped: %v", err)
 	}
 }
+
+// eventsServerURL returns the URL events of this supervisord are reported
+// under, EVENTS_SERVER_URL or the only server configured
+func eventsServerURL() string {
+	if config.EventsServerURL != "" {
+		return config.EventsServerURL
+	}
+	if len(config.Servers) != 1 {
+		log.Fatalf("EVENTS_SERVER_URL is required with %d servers configured, set it to the URL of this supervisord", len(config.Servers))
+	}
+	return config.Servers[0].URL
+}
+
+// newStore returns the store of the monitor state, STATE_FILE or none
+func newStore() state.Store {
+	if config.StateFile == "" {
+		return state.Discard{}
+	}
+	return state.NewFileStore(config.StateFile)
+}
+
+func newSupervisorClients() map[string]supervisor.ProcessManager {
+	supervisorClients := make(map[string]supervisor.ProcessManager)
+
+	for _, server := range config.Servers {
+		opts := supervisor.Options{
+			TLS: &supervisor.TLSOptions{
+				CAFile:             server.CAFile,
+				CertFile:           server.CertFile,
+				KeyFile:            server.KeyFile,
+				InsecureSkipVerify: server.InsecureSkipVerify,
+			},
+			ConnectTimeout: server.ConnectTimeout.Duration,
+			CallTimeout:    server.CallTimeout.Duration,
+			WaitTimeout:    server.WaitTimeout.Duration,
+			Retry: supervisor.RetryOptions{
+				Attempts:       config.RetryAttempts,
+				InitialBackoff: config.RetryBackoff,
+				MaxBackoff:     config.RetryMaxBackoff,
+			},
+			Breaker: supervisor.BreakerOptions{
+				FailureThreshold: config.BreakerThreshold,
+				OpenTimeout:      config.BreakerOpenTimeout,
+			},
+		}
+		if server.Username != "" || server.Password != "" {
+			opts.Auth = &supervisor.BasicAuth{
+				Username: server.Username,
+				Password: server.Password,
+			}
+		}
+
+		client, err := supervisor.NewClient(server.URL, opts)
+		if err != nil {
+			log.Fatalf("Error creating supervisor client for %s: %v", server.URL, err)
+		}
+		supervisorClients[server.URL] = client
+	}
+	return supervisorClients
+}
+
+func newHandler(supervisorClients map[string]supervisor.ProcessManager, store state.Store) *tgbot.Handler {
+	bot, err := tgbotapi.NewBotAPI(config.TelegramBotToken)
+	if err != nil {
+		log.Fatalf("Error creating Telegram bot: %v", err)
+	}
+	log.Printf("Authorized on account %s", bot.Self.UserName)
+
+	return tgbot.NewHandler(bot, supervisorClients, store)
+}
@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is one action taken through the bot
+type Entry struct {
+	Time   time.Time `json:"time"`
+	UserID int64     `json:"user_id"`
+	User   string    `json:"user"` // @username, or the name when there is none
+	ChatID int64     `json:"chat_id"`
+	Server string    `json:"server"`
+	Target string    `json:"target,omitempty"` // process or group, empty for server-wide actions
+	Action string    `json:"action"`
+	Result string    `json:"result"` // "ok" or the error
+}
+
+// Log is an append-only file of entries, one JSON object per line
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens the log at path for appending, creating it if needed
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{file: file}, nil
+}
+
+// Record appends an entry and syncs it to disk before returning
+func (l *Log) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return l.file.Sync()
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// Filter selects entries. Zero fields match everything.
+type Filter struct {
+	User   string // user ID, or username with or without "@"
+	Target string // substring of the process or group
+	Since  time.Time
+	Until  time.Time // exclusive
+	Limit  int       // newest entries to return, all when zero
+}
+
+func (f Filter) matches(entry Entry) bool {
+	if f.User != "" {
+		user := strings.TrimPrefix(f.User, "@")
+		if user != fmt.Sprint(entry.UserID) && !strings.EqualFold("@"+user, entry.User) {
+			return false
+		}
+	}
+	if f.Target != "" && !strings.Contains(strings.ToLower(entry.Target), strings.ToLower(f.Target)) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Query returns the entries matching filter, newest first. Lines that fail
+// to parse, such as one cut short by a crash, are skipped.
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// rejectNotifyInterval limits admin chat notifications to one per sender
+const rejectNotifyInterval = time.Hour
+
+// isAllowed reports whether an update from user in chatID may be acted on.
+// Admins and ALLOWED_USER_IDS are allowed anywhere, everyone is allowed in
+// TELEGRAM_CHAT_ID and the chats in ALLOWED_CHAT_IDS.
+func isAllowed(user *tgbotapi.User, chatID int64) bool {
+	if chatID == config.TelegramChatID || containsID(config.AllowedChatIDs, chatID) {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	return isAdmin(user) || containsID(config.AllowedUserIDs, user.ID) || config.Permissions.HasUser(user.ID)
+}
+
+// isAdmin reports whether the Telegram user is listed in ADMIN_USER_IDS
+func isAdmin(user *tgbotapi.User) bool {
+	return user != nil && containsID(config.AdminUserIDs, user.ID)
+}
+
+// roleFor returns the user's role on a server and process group, or on the
+// whole server when group is empty
+func roleFor(user *tgbotapi.User, serverURL, group string) permissions.Role {
+	if user == nil {
+		return permissions.RoleNone
+	}
+	return config.Permissions.RoleFor(user.ID, serverURL, group)
+}
+
+// permitted checks that the user may perform action on a server and group and
+// tells them when they may not. Every callback and command acting on a server
+// must go through it.
+func (h *Handler) permitted(chatID int64, user *tgbotapi.User, action permissions.Action, serverURL, group string) bool {
+	role := roleFor(user, serverURL, group)
+	if role.Can(action) {
+		return true
+	}
+
+	scope := serverURL
+	if group != "" {
+		scope = group + " on " + serverURL
+	}
+	log.Printf("Denied %s to %s with role %s on %s", action, describeUser(user), role, scope)
+	telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("⛔ Your role `%s` can't %s on `%s`",
+		role, telegram.EscapeMarkdownV2(action.String()), telegram.EscapeMarkdownV2(scope)))
+	return false
+}
+
+// processGroup returns the group of a process given by its "group:name" form.
+// Processes of single-process programs are in a group of their own name.
+func processGroup(processName string) string {
+	if group, _, ok := strings.Cut(processName, ":"); ok {
+		return group
+	}
+	return processName
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectUpdate logs an update from a sender that is not allowed and tells the
+// admin chat about it, at most once per sender and rejectNotifyInterval
+func (h *Handler) rejectUpdate(user *tgbotapi.User, chat *tgbotapi.Chat, what string) {
+	sender := describeUser(user)
+	log.Printf("Rejected %s from %s in chat %d", what, sender, chat.ID)
+
+	if config.AdminChatID == 0 {
+		return
+	}
+	var userID int64
+	if user != nil {
+		userID = user.ID
+	}
+	h.mu.Lock()
+	last, seen := h.rejected[userID]
+	if seen && time.Since(last) < rejectNotifyInterval {
+		h.mu.Unlock()
+		return
+	}
+	h.rejected[userID] = time.Now()
+	h.mu.Unlock()
+
+	message := fmt.Sprintf("🚫 *Rejected %s*\n*From:* `%s`\n*Chat:* `%d` \\(%s\\)",
+		telegram.EscapeMarkdownV2(what), telegram.EscapeMarkdownV2(sender), chat.ID, telegram.EscapeMarkdownV2(chat.Type))
+	if err := telegram.SendToTelegram(h.bot, config.AdminChatID, message); err != nil {
+		log.Printf("Error notifying admin chat about rejected %s: %v", what, err)
+	}
+}
+
+// describeUser identifies a Telegram user in logs: ID, username and name
+func describeUser(user *tgbotapi.User) string {
+	if user == nil {
+		return "unknown user"
+	}
+	description := fmt.Sprintf("user %d", user.ID)
+	if user.UserName != "" {
+		description += " @" + user.UserName
+	}
+	if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+		description += fmt.Sprintf(" (%s)", name)
+	}
+	return description
+}
+
+// rejectCallback rejects a button press and tells the sender why
+func (h *Handler) rejectCallback(query *tgbotapi.CallbackQuery) {
+	chat := &tgbotapi.Chat{}
+	if query.Message != nil {
+		chat = query.Message.Chat
+	}
+	h.rejectUpdate(query.From, chat, "button press")
+
+	callback := tgbotapi.NewCallback(query.ID, "⛔ You are not allowed to use this bot")
+	if _, err := h.bot.Request(callback); err != nil {
+		log.Printf("Error acknowledging callback: %v", err)
+	}
+}
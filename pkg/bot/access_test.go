@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+const testAdminChatID = 900
+
+// withAccessLists sets ALLOWED_USER_IDS, ALLOWED_CHAT_IDS and ADMIN_CHAT_ID
+// for one test
+func withAccessLists(t *testing.T, users, chats []int64) {
+	t.Helper()
+	allowedUsers, allowedChats, adminChat := config.AllowedUserIDs, config.AllowedChatIDs, config.AdminChatID
+	t.Cleanup(func() {
+		config.AllowedUserIDs, config.AllowedChatIDs, config.AdminChatID = allowedUsers, allowedChats, adminChat
+	})
+	config.AllowedUserIDs, config.AllowedChatIDs, config.AdminChatID = users, chats, testAdminChatID
+}
+
+// statusUpdate is "/status web" sent by user in chat
+func statusUpdate(user *tgbotapi.User, chat *tgbotapi.Chat) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: 1,
+		From:      user,
+		Chat:      chat,
+		Text:      "/status web",
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len("/status")}},
+	}}
+}
+
+func TestStrangersAreRejected(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	withAccessLists(t, []int64{60}, []int64{-300})
+	stranger := &tgbotapi.User{ID: 50, UserName: "mallory"}
+	before := len(server.Calls())
+
+	// A private chat
+	h.handleUpdate(statusUpdate(stranger, &tgbotapi.Chat{ID: 50, Type: "private"}))
+	// A group that is not listed, with a button from a forwarded card
+	h.handleUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    stranger,
+		Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: -200, Type: "group"}},
+		Data:    telegram.EncodeCallback(telegram.Callback{Action: "stop", ServerURL: server.URL, Target: "web"}),
+	}})
+
+	for _, call := range server.Calls()[before:] {
+		t.Errorf("a stranger's update called %s", call)
+	}
+	if replies := append(tg.sent(50, ""), tg.sent(-200, "")...); len(replies) != 0 {
+		t.Errorf("strangers got %+v, want no replies", replies)
+	}
+	if answers := tg.sent(0, "You are not allowed to use this bot"); len(answers) != 1 {
+		t.Errorf("got %d refused button answers, want 1", len(answers))
+	}
+	if notices := tg.sent(testAdminChatID, "mallory"); len(notices) != 1 {
+		t.Errorf("got %d admin notices, want 1 per sender", len(notices))
+	}
+}
+
+func TestAllowedUsersAndChats(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	withAccessLists(t, []int64{60}, []int64{-300})
+
+	// ALLOWED_USER_IDS works in any chat, ALLOWED_CHAT_IDS for anyone in it
+	h.handleUpdate(statusUpdate(&tgbotapi.User{ID: 60}, &tgbotapi.Chat{ID: 60, Type: "private"}))
+	h.handleUpdate(statusUpdate(&tgbotapi.User{ID: 70}, &tgbotapi.Chat{ID: -300, Type: "group"}))
+	for _, chatID := range []int64{60, -300} {
+		if cards := tg.sent(chatID, "*Process Details*"); len(cards) != 1 {
+			t.Errorf("chat %d got %d details cards, want 1", chatID, len(cards))
+		}
+	}
+	if notices := tg.sent(testAdminChatID, ""); len(notices) != 0 {
+		t.Errorf("allowed users were reported: %+v", notices)
+	}
+	if len(server.Calls()) == 0 {
+		t.Error("no supervisor calls for allowed users")
+	}
+}
+
+func TestRejectNoticeIsRateLimited(t *testing.T) {
+	h, _, tg := newTestHandler(t)
+	withAccessLists(t, nil, nil)
+	mallory := &tgbotapi.User{ID: 50, UserName: "mallory"}
+	trudy := &tgbotapi.User{ID: 51, UserName: "trudy"}
+
+	for i := 0; i < 3; i++ {
+		h.handleUpdate(statusUpdate(mallory, &tgbotapi.Chat{ID: 50, Type: "private"}))
+	}
+	h.handleUpdate(statusUpdate(trudy, &tgbotapi.Chat{ID: 51, Type: "private"}))
+	if notices := tg.sent(testAdminChatID, "mallory"); len(notices) != 1 {
+		t.Errorf("got %d notices for repeated attempts, want 1", len(notices))
+	}
+	if notices := tg.sent(testAdminChatID, "trudy"); len(notices) != 1 {
+		t.Errorf("got %d notices for another sender, want 1", len(notices))
+	}
+
+	// Once the interval passed the sender is reported again
+	h.mu.Lock()
+	h.rejected[mallory.ID] = time.Now().Add(-rejectNotifyInterval - time.Minute)
+	h.mu.Unlock()
+	h.handleUpdate(statusUpdate(mallory, &tgbotapi.Chat{ID: 50, Type: "private"}))
+	if notices := tg.sent(testAdminChatID, "mallory"); len(notices) != 2 {
+		t.Errorf("got %d notices after the interval, want 2", len(notices))
+	}
+}
@@ -0,0 +1,216 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/audit"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+const (
+	defaultAuditLimit = 20
+	maxAuditLimit     = 50
+)
+
+// recordAction appends an action and its outcome to the audit log
+func (h *Handler) recordAction(chatID int64, user *tgbotapi.User, serverURL, target, action string, err error) {
+	if h.auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Time:   time.Now(),
+		ChatID: chatID,
+		Server: serverURL,
+		Target: target,
+		Action: action,
+		Result: "ok",
+	}
+	if user != nil {
+		entry.UserID = user.ID
+		entry.User = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		if user.UserName != "" {
+			entry.User = "@" + user.UserName
+		}
+	}
+	if err != nil {
+		entry.Result = err.Error()
+	}
+	if err := h.auditLog.Record(entry); err != nil {
+		log.Printf("Error writing audit log entry %+v: %v", entry, err)
+	}
+}
+
+// parseAuditFilter parses "user=", "process=", "since=", "until=" and
+// "limit=" filters, the limit being the entries per page. Times are durations
+// back from now such as "24h" or "7d", or dates such as "2024-05-01" or
+// "2024-05-01T15:04" in local time. "until=" with a date alone includes that
+// day.
+func parseAuditFilter(query string, now time.Time) (audit.Filter, error) {
+	filter := audit.Filter{Limit: defaultAuditLimit}
+	for _, field := range strings.Fields(query) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || value == "" {
+			return audit.Filter{}, fmt.Errorf("expected key=value, got %q", field)
+		}
+		var err error
+		switch strings.ToLower(key) {
+		case "user":
+			filter.User = value
+		case "process":
+			filter.Target = value
+		case "since":
+			filter.Since, err = parseAuditTime(value, now, false)
+		case "until":
+			filter.Until, err = parseAuditTime(value, now, true)
+		case "limit":
+			filter.Limit, err = strconv.Atoi(value)
+			if err == nil && (filter.Limit < 1 || filter.Limit > maxAuditLimit) {
+				err = fmt.Errorf("limit must be between 1 and %d", maxAuditLimit)
+			}
+		default:
+			return audit.Filter{}, fmt.Errorf("unknown filter %q", key)
+		}
+		if err != nil {
+			return audit.Filter{}, err
+		}
+	}
+	return filter, nil
+}
+
+// parseAuditTime parses a since= or until= time, the end of a range when end
+// is set
+func parseAuditTime(value string, now time.Time, end bool) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && strings.HasSuffix(value, "d") {
+		return now.AddDate(0, 0, -days), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if end {
+			// Up to the start of the next day, the range ends before it
+			return t.AddDate(0, 0, 1), nil
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use a duration like 24h or 7d or a date like 2024-05-01", value)
+}
+
+// auditPageChars keeps an /audit page below Telegram's limit of 4096
+// characters, leaving room for the header
+const auditPageChars = 3500
+
+// auditPage picks one page out of entries, which are newest first. Pages are
+// addressed by positions counted from the oldest entry, so they stay put while
+// new actions are recorded. The page holds up to limit entries that fit in
+// auditPageChars: those before position offset (-1 for the newest), or from
+// offset on when after is set. It returns them newest first together with the
+// positions of the oldest one and of the one after the newest.
+func auditPage(entries []audit.Entry, offset int, after bool, limit int) ([]audit.Entry, int, int) {
+	n := len(entries)
+	at := func(position int) audit.Entry {
+		return entries[n-1-position]
+	}
+	fits := func(taken, size int, entry audit.Entry) bool {
+		return taken == 0 || (taken < limit && size+len(telegram.FormatAuditEntry(entry)) <= auditPageChars)
+	}
+
+	from, to := offset, offset
+	size := 0
+	if after && offset >= 0 && offset < n {
+		for to < n && fits(to-from, size, at(to)) {
+			size += len(telegram.FormatAuditEntry(at(to)))
+			to++
+		}
+	} else {
+		if offset < 0 || offset > n {
+			to = n
+		}
+		from = to
+		for from > 0 && fits(to-from, size, at(from-1)) {
+			from--
+			size += len(telegram.FormatAuditEntry(at(from)))
+		}
+	}
+
+	page := make([]audit.Entry, 0, to-from)
+	for position := to - 1; position >= from; position-- {
+		page = append(page, at(position))
+	}
+	return page, from, to
+}
+
+// ShowAudit lists the latest audit entries matching query on the servers the
+// user administers
+func (h *Handler) ShowAudit(chatID int64, user *tgbotapi.User, query string) {
+	h.showAuditPage(chatID, 0, user, query, -1, false)
+}
+
+// showAuditPage shows a page of the audit entries matching query, see
+// auditPage. It edits the message with messageID, or sends a new message
+// when messageID is 0.
+func (h *Handler) showAuditPage(chatID int64, messageID int, user *tgbotapi.User, query string, offset int, after bool) {
+	if h.auditLog == nil {
+		telegram.SendToTelegram(h.bot, chatID, "The audit log is disabled, set `AUDIT_FILE` to enable it\\.")
+		return
+	}
+	var servers []string
+	for serverURL := range h.supervisorClients {
+		if roleFor(user, serverURL, "").Can(permissions.ActionAdmin) {
+			servers = append(servers, serverURL)
+		}
+	}
+	if len(servers) == 0 {
+		telegram.SendToTelegram(h.bot, chatID, "⛔ Only admins can read the audit log\\.")
+		return
+	}
+
+	filter, err := parseAuditFilter(query, time.Now())
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, "❌ "+telegram.EscapeMarkdownV2(err.Error()))
+		return
+	}
+	limit := filter.Limit
+	filter.Limit = 0
+
+	entries, err := h.auditLog.Query(filter)
+	if err != nil {
+		log.Printf("Error reading audit log: %v", err)
+		telegram.SendToTelegram(h.bot, chatID, "❌ "+telegram.EscapeMarkdownV2(err.Error()))
+		return
+	}
+	// Entries of servers since removed from the config are for global admins
+	visible := entries[:0]
+	for _, entry := range entries {
+		_, configured := h.supervisorClients[entry.Server]
+		if contains(servers, entry.Server) || (!configured && isAdmin(user)) {
+			visible = append(visible, entry)
+		}
+	}
+
+	page, from, to := auditPage(visible, offset, after, limit)
+	olderEnd, newerStart := -1, -1
+	if from > 0 {
+		olderEnd = from
+	}
+	if to < len(visible) {
+		newerStart = to
+	}
+	message := telegram.FormatAuditEntries(page, query, len(visible)-to+1, len(visible))
+	keyboard := telegram.BuildAuditKeyboard(query, olderEnd, newerStart)
+	if messageID == 0 {
+		telegram.SendToTelegramWithInlineKeyboard(h.bot, chatID, message, keyboard)
+		return
+	}
+	h.editMessage(chatID, messageID, message, keyboard)
+}
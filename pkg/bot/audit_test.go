@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/audit"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+func TestParseAuditFilter(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		query   string
+		want    audit.Filter
+		wantErr string
+	}{
+		{query: "", want: audit.Filter{Limit: defaultAuditLimit}},
+		{query: "user=@alice process=web", want: audit.Filter{User: "@alice", Target: "web", Limit: defaultAuditLimit}},
+		{query: "USER=42 limit=5", want: audit.Filter{User: "42", Limit: 5}},
+		{query: "since=24h", want: audit.Filter{Since: now.Add(-24 * time.Hour), Limit: defaultAuditLimit}},
+		{query: "since=7d", want: audit.Filter{Since: now.AddDate(0, 0, -7), Limit: defaultAuditLimit}},
+		{
+			query: "since=2024-05-01 until=2024-05-02T15:04",
+			want: audit.Filter{
+				Since: time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local),
+				Until: time.Date(2024, 5, 2, 15, 4, 0, 0, time.Local),
+				Limit: defaultAuditLimit,
+			},
+		},
+		{
+			query: "until=2024-05-02",
+			want:  audit.Filter{Until: time.Date(2024, 5, 3, 0, 0, 0, 0, time.Local), Limit: defaultAuditLimit},
+		},
+		{query: "web", wantErr: "expected key=value"},
+		{query: "user=", wantErr: "expected key=value"},
+		{query: "host=a", wantErr: "unknown filter"},
+		{query: "limit=0", wantErr: "limit must be between"},
+		{query: "limit=51", wantErr: "limit must be between"},
+		{query: "limit=many", wantErr: "invalid syntax"},
+		{query: "since=yesterday", wantErr: "invalid time"},
+	}
+	for _, tt := range tests {
+		got, err := parseAuditFilter(tt.query, now)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseAuditFilter(%q) error = %v, want %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAuditFilter(%q) error = %v", tt.query, err)
+			continue
+		}
+		if got.User != tt.want.User || got.Target != tt.want.Target || got.Limit != tt.want.Limit ||
+			!got.Since.Equal(tt.want.Since) || !got.Until.Equal(tt.want.Until) {
+			t.Errorf("parseAuditFilter(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// auditEntries returns n entries, newest first, whose targets are their
+// positions counted from the oldest
+func auditEntries(n int, result string) []audit.Entry {
+	entries := make([]audit.Entry, n)
+	for i := range entries {
+		entries[i] = audit.Entry{Action: "stop", Target: string(rune('a' + n - 1 - i)), Result: result}
+	}
+	return entries
+}
+
+func targets(entries []audit.Entry) string {
+	var s strings.Builder
+	for _, entry := range entries {
+		s.WriteString(entry.Target)
+	}
+	return s.String()
+}
+
+func TestAuditPage(t *testing.T) {
+	entries := auditEntries(7, "ok")
+	tests := []struct {
+		name     string
+		offset   int
+		after    bool
+		limit    int
+		want     string
+		from, to int
+	}{
+		{name: "newest", offset: -1, limit: 3, want: "gfe", from: 4, to: 7},
+		{name: "older", offset: 4, limit: 3, want: "dcb", from: 1, to: 4},
+		{name: "oldest partial", offset: 1, limit: 3, want: "a", from: 0, to: 1},
+		{name: "newer", offset: 1, after: true, limit: 3, want: "dcb", from: 1, to: 4},
+		{name: "newest partial", offset: 5, after: true, limit: 3, want: "gf", from: 5, to: 7},
+		{name: "newer past the end", offset: 7, after: true, limit: 3, want: "gfe", from: 4, to: 7},
+		{name: "offset past the end", offset: 9, limit: 3, want: "gfe", from: 4, to: 7},
+		{name: "all", offset: -1, limit: 50, want: "gfedcba", from: 0, to: 7},
+	}
+	for _, tt := range tests {
+		page, from, to := auditPage(entries, tt.offset, tt.after, tt.limit)
+		if got := targets(page); got != tt.want || from != tt.from || to != tt.to {
+			t.Errorf("%s: auditPage(%d, %v, %d) = %q, %d, %d, want %q, %d, %d",
+				tt.name, tt.offset, tt.after, tt.limit, got, from, to, tt.want, tt.from, tt.to)
+		}
+	}
+
+	page, from, to := auditPage(nil, -1, false, 20)
+	if len(page) != 0 || from != 0 || to != 0 {
+		t.Errorf("auditPage(nil) = %v, %d, %d, want no entries", page, from, to)
+	}
+}
+
+func TestAuditPageFitsMessage(t *testing.T) {
+	// Group actions fail with one long error per process
+	entries := auditEntries(maxAuditLimit, strings.Repeat("group:web_01: SPAWN_ERROR; ", 40))
+
+	for _, after := range []bool{false, true} {
+		offset := -1
+		if after {
+			offset = 0
+		}
+		page, from, to := auditPage(entries, offset, after, maxAuditLimit)
+		if len(page) == 0 || len(page) == maxAuditLimit {
+			t.Fatalf("after=%v: got %d entries, want the page cut short", after, len(page))
+		}
+		if to-from != len(page) {
+			t.Errorf("after=%v: positions %d-%d don't match %d entries", after, from, to, len(page))
+		}
+		if size := len(telegram.FormatAuditEntries(page, "limit=50", 1, len(entries))); size > 4096 {
+			t.Errorf("after=%v: page is %d characters, over Telegram's limit", after, size)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/utils"
+)
+
+// argKind is how a command argument is parsed
+type argKind int
+
+const (
+	argWord    argKind = iota // a single word
+	argProcess                // a process as "name[@server]"
+	argText                   // the rest of the message, spaces included
+)
+
+// commandArg describes one argument of a command
+type commandArg struct {
+	name     string
+	kind     argKind
+	optional bool
+	choices  []string // allowed values of a word, any when empty
+}
+
+// commandArgs holds the parsed arguments of a command by name
+type commandArgs map[string]string
+
+// String returns an argument, or "" when it was left out
+func (a commandArgs) String(name string) string {
+	return a[name]
+}
+
+// command is a slash command: its arguments, help and what it runs
+type command struct {
+	name        string
+	args        []commandArg
+	description string // shown in the Telegram command menu
+	help        string // shown by /help <command>, MarkdownV2
+	ignoreArgs  bool   // takes no arguments but doesn't refuse them either
+	run         func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs)
+}
+
+// commands lists every command in the order /help shows them. It is filled
+// in init because /help itself refers to it.
+var commands []command
+
+func init() {
+	process := commandArg{name: "process", kind: argProcess}
+	commands = []command{
+		{
+			name:        "status",
+			args:        []commandArg{{name: "process", kind: argProcess, optional: true}},
+			description: "Show all processes, or one process in detail",
+			help:        "Without a process, lists every process by server, group and state\\. With one, shows its details card with control buttons\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				if args.String("process") == "" {
+					h.ShowAllProcesses(ctx, message.Chat.ID, message.From)
+					return
+				}
+				h.runProcessCommand(ctx, message, args.String("process"), "")
+			},
+		},
+		{
+			name:        "start",
+			description: "Show the overview",
+			help:        "Shows the same overview as /status\\. Anything after it, like the payload of a deep link, starts nothing, use /startproc to start a process\\.",
+			ignoreArgs:  true,
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.ShowAllProcesses(ctx, message.Chat.ID, message.From)
+				h.hintStartProc(ctx, message)
+			},
+		},
+		{
+			name:        "startproc",
+			args:        []commandArg{process},
+			description: "Start a process",
+			help:        "Starts the process and shows its details card\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.StartProcess(ctx, message, args.String("process"))
+			},
+		},
+		{
+			name:        "stop",
+			args:        []commandArg{process},
+			description: "Stop a process",
+			help:        "Stops the process\\. Like the 🛑 Stop button, it asks for confirmation unless the server has `skip_confirm` set\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.StopProcess(ctx, message, args.String("process"))
+			},
+		},
+		{
+			name:        "restart",
+			args:        []commandArg{process},
+			description: "Restart a process",
+			help:        "Restarts the process\\. Like the 🔄 Restart button, it asks for confirmation unless the server has `skip_confirm` set\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.runProcessCommand(ctx, message, args.String("process"), "restart")
+			},
+		},
+		{
+			name:        "logs",
+			args:        []commandArg{process, {name: "stream", kind: argWord, optional: true, choices: []string{"out", "err"}}},
+			description: "Show the latest log output of a process",
+			help:        "Shows the tail of the process's stdout log, or of stderr with `err`, with buttons to page through it\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				stream := args.String("stream")
+				if stream == "" {
+					stream = "out"
+				}
+				h.runProcessCommand(ctx, message, args.String("process"), "log", stream, "-1")
+			},
+		},
+		{
+			name:        "find",
+			args:        []commandArg{{name: "query", kind: argText, optional: true}},
+			description: "Find processes by name, group, description, state or server",
+			help: "Lists the matching processes page by page, each linking to its details card\\. " +
+				"Text matches the name, group or description ignoring case, `/regex/` matches a regular expression\\. " +
+				"Filter with `state=FATAL,BACKOFF` and `server=<url, short ID or host>`\\. " +
+				"Example: `/find worker state=FATAL server=prod-1:9001`",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.FindProcesses(ctx, message.Chat.ID, message.From, args.String("query"))
+			},
+		},
+		{
+			name:        "servers",
+			description: "List the supervisord servers",
+			help:        "Lists every server with its state and short ID, which other commands accept after `@`\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.ShowServers(ctx, message.Chat.ID, message.From)
+			},
+		},
+		{
+			name:        "subscribe",
+			description: "Choose processes to get failure alerts for",
+			help: "Shows ✅/⬜ toggles for every server, and for the groups and processes on each\\. " +
+				"Failures of what you pick are also sent to you in a private chat, so start a chat with the bot first\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.ShowSubscriptions(message.Chat.ID, 0, message.From)
+			},
+		},
+		{
+			name:        "mutes",
+			description: "List muted alerts and lift mutes",
+			help: "Lists the processes whose alerts were snoozed or muted from an alert message, with buttons to unmute them\\. " +
+				"Snoozes end after their time, mutes until fixed end once the process is seen RUNNING again\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.ShowMutes(message.Chat.ID, 0, message.From)
+			},
+		},
+		{
+			name:        "audit",
+			args:        []commandArg{{name: "filters", kind: argText, optional: true}},
+			description: "Show who did what, admins only",
+			help: "Lists the latest control actions on the servers you administer with user, chat, target and result, newest first\\. " +
+				"Filter with `user=<id or @username>`, `process=<name>`, `since=` and `until=` taking a duration like `24h` or a date like `2024-05-01`, " +
+				"and `limit=<1-50>` entries per page\\. Example: `/audit user=@alice since=7d`",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.ShowAudit(message.Chat.ID, message.From, args.String("filters"))
+			},
+		},
+		{
+			name:        "reload",
+			description: "Reread and apply the supervisord configuration",
+			help:        "Rereads the configuration on every server you administer and offers to apply the changes like `supervisorctl update`\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.ShowConfigChanges(ctx, message.Chat.ID, message.From)
+			},
+		},
+		{
+			name:        "stdin",
+			args:        []commandArg{process, {name: "text", kind: argText}},
+			description: "Write a line to a process's stdin",
+			help:        "Sends the text and a newline to the process's stdin\\. Admins only\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.SendStdin(ctx, message.Chat.ID, message.From, args.String("process"), args.String("text"))
+			},
+		},
+		{
+			name:        "help",
+			args:        []commandArg{{name: "command", kind: argWord, optional: true}},
+			description: "List the commands, or explain one",
+			help:        "Lists every command\\. With a command name, shows its usage and what it does\\.",
+			run: func(h *Handler, ctx context.Context, message *tgbotapi.Message, args commandArgs) {
+				h.showHelp(message.Chat.ID, args.String("command"))
+			},
+		},
+	}
+}
+
+// findCommand looks a command up by name, with or without the slash
+func findCommand(name string) (command, bool) {
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// usage renders a command line like "/logs <process>[@server] [out|err]"
+func (c command) usage() string {
+	parts := []string{"/" + c.name}
+	for _, arg := range c.args {
+		name := "<" + arg.name + ">"
+		switch {
+		case len(arg.choices) > 0:
+			name = strings.Join(arg.choices, "|")
+		case arg.kind == argProcess:
+			name = "<process>[@server]"
+		}
+		if arg.optional {
+			name = "[" + name + "]"
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseArgs splits the text after a command into its arguments
+func (c command) parseArgs(text string) (commandArgs, error) {
+	args := make(commandArgs)
+	rest := strings.TrimSpace(text)
+	for _, arg := range c.args {
+		var value string
+		if arg.kind == argText {
+			value, rest = rest, ""
+		} else {
+			value, rest, _ = strings.Cut(rest, " ")
+			rest = strings.TrimSpace(rest)
+		}
+
+		if value == "" {
+			if arg.optional {
+				continue
+			}
+			return nil, fmt.Errorf("missing %s", arg.name)
+		}
+		if len(arg.choices) > 0 && !contains(arg.choices, value) {
+			return nil, fmt.Errorf("%s must be one of %s, got %q", arg.name, strings.Join(arg.choices, ", "), value)
+		}
+		args[arg.name] = value
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %q", rest)
+	}
+	return args, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// runCommand parses and runs a slash command message
+func (h *Handler) runCommand(ctx context.Context, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	cmd, ok := findCommand(message.Command())
+	if !ok {
+		telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("Unknown command `/%s`\\. Send /help to see the available commands\\.",
+			telegram.EscapeMarkdownV2(message.Command())))
+		return
+	}
+
+	args := commandArgs{}
+	var err error
+	if !cmd.ignoreArgs {
+		args, err = cmd.parseArgs(message.CommandArguments())
+	}
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("❌ %s\nUsage: `%s`",
+			telegram.EscapeMarkdownV2(capitalize(err.Error())), telegram.EscapeMarkdownV2Code(cmd.usage())))
+		return
+	}
+	cmd.run(h, ctx, message, args)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// showHelp lists every command, or the usage and help of one
+func (h *Handler) showHelp(chatID int64, name string) {
+	if name != "" {
+		cmd, ok := findCommand(name)
+		if !ok {
+			telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("Unknown command `%s`\\. Send /help to see the available commands\\.",
+				telegram.EscapeMarkdownV2(name)))
+			return
+		}
+		telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("`%s`\n\n%s", telegram.EscapeMarkdownV2Code(cmd.usage()), cmd.help))
+		return
+	}
+
+	var message strings.Builder
+	message.WriteString("*Commands*\n\n")
+	for _, cmd := range commands {
+		message.WriteString(fmt.Sprintf("`%s`\n%s\n\n", telegram.EscapeMarkdownV2Code(cmd.usage()), telegram.EscapeMarkdownV2(cmd.description)))
+	}
+	message.WriteString("Send `/help <command>` for details\\.")
+	telegram.SendToTelegram(h.bot, chatID, message.String())
+}
+
+// RegisterCommands publishes the command list to Telegram so clients offer
+// it as the user types "/"
+func (h *Handler) RegisterCommands() {
+	botCommands := make([]tgbotapi.BotCommand, 0, len(commands))
+	for _, cmd := range commands {
+		botCommands = append(botCommands, tgbotapi.BotCommand{Command: cmd.name, Description: cmd.description})
+	}
+	if _, err := h.bot.Request(tgbotapi.NewSetMyCommands(botCommands...)); err != nil {
+		log.Printf("Error registering bot commands: %v", err)
+	}
+}
+
+// resolveProcess finds the single process a "name[@server]" argument refers
+// to among those the user can view, telling them when there is none or more
+// than one
+func (h *Handler) resolveProcess(ctx context.Context, chatID int64, user *tgbotapi.User, target string) (models.Process, bool) {
+	processName, server, _ := strings.Cut(target, "@")
+	var matches []models.Process
+	for _, process := range h.findProcesses(ctx, processName, server) {
+		if roleFor(user, process.ServerURL, process.Group).Can(permissions.ActionView) {
+			matches = append(matches, process)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("Process `%s` not found", telegram.EscapeMarkdownV2(target)))
+		return models.Process{}, false
+	case 1:
+		return matches[0], true
+	}
+
+	var servers []string
+	for _, process := range matches {
+		servers = append(servers, fmt.Sprintf("• `%s@%s` on %s", telegram.EscapeMarkdownV2(process.FullName()),
+			utils.GetShortServerId(process.ServerURL), telegram.EscapeMarkdownV2(process.ServerURL)))
+	}
+	telegram.SendToTelegram(h.bot, chatID, "Process found on several servers, pick one:\n"+strings.Join(servers, "\n"))
+	return models.Process{}, false
+}
+
+// hintStartProc points to /startproc when "/start <process>" names a process
+// the user can view, /start itself only greets
+func (h *Handler) hintStartProc(ctx context.Context, message *tgbotapi.Message) {
+	target := strings.TrimSpace(message.CommandArguments())
+	if target == "" {
+		return
+	}
+	processName, server, _ := strings.Cut(target, "@")
+	for _, process := range h.findProcesses(ctx, processName, server) {
+		if roleFor(message.From, process.ServerURL, process.Group).Can(permissions.ActionView) {
+			telegram.SendToTelegram(h.bot, message.Chat.ID, fmt.Sprintf("/start doesn't start processes, use `/startproc %s`",
+				telegram.EscapeMarkdownV2Code(target)))
+			return
+		}
+	}
+}
+
+// runProcessCommand sends the details card of a process and, unless action
+// is empty, presses one of its buttons. Commands thereby go through the same
+// permission checks and confirmations as the buttons.
+func (h *Handler) runProcessCommand(ctx context.Context, message *tgbotapi.Message, target, action string, args ...string) {
+	chatID := message.Chat.ID
+	process, ok := h.resolveProcess(ctx, chatID, message.From, target)
+	if !ok {
+		return
+	}
+	if !h.permitted(chatID, message.From, permissions.ActionView, process.ServerURL, process.Group) {
+		return
+	}
+
+	card := tgbotapi.NewMessage(chatID, telegram.FormatProcessDetails(process))
+	card.ParseMode = "MarkdownV2"
+	card.ReplyMarkup = telegram.BuildProcessControlKeyboard(process,
+		roleFor(message.From, process.ServerURL, process.Group), roleFor(message.From, process.ServerURL, ""))
+	sent, err := h.bot.Send(card)
+	if err != nil {
+		log.Printf("Error sending process details: %v", err)
+		return
+	}
+	if action == "" {
+		return
+	}
+
+	cb := telegram.Callback{Action: action, ServerURL: process.ServerURL, Target: process.FullName(), Args: args}
+	query := &tgbotapi.CallbackQuery{From: message.From, Message: &sent}
+	if !h.confirmFirst(query, cb) {
+		h.dispatchCallback(query, cb)
+	}
+}
+
+// ShowServers lists the servers the user can see with their state
+func (h *Handler) ShowServers(ctx context.Context, chatID int64, user *tgbotapi.User) {
+	var serverURLs []string
+	for serverURL := range h.supervisorClients {
+		if roleFor(user, serverURL, "").Can(permissions.ActionView) {
+			serverURLs = append(serverURLs, serverURL)
+		}
+	}
+	if len(serverURLs) == 0 {
+		telegram.SendToTelegram(h.bot, chatID, "No servers to show\\.")
+		return
+	}
+	sort.Strings(serverURLs)
+
+	var message strings.Builder
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	message.WriteString("*Servers*\n\n")
+	for _, serverURL := range serverURLs {
+		client := h.supervisorClients[serverURL]
+		state, err := client.GetState(ctx)
+		if err != nil {
+			state = "UNREACHABLE"
+		}
+		message.WriteString(fmt.Sprintf("*%s* \\(`%s`\\)\nState: `%s`, %s\n\n",
+			telegram.EscapeMarkdownV2(serverURL), utils.GetShortServerId(serverURL),
+			telegram.EscapeMarkdownV2(state), telegram.FormatBreakerState(client.BreakerState())))
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			telegram.CallbackButton("🖥 "+serverName(serverURL), telegram.Callback{Action: "server", ServerURL: serverURL}),
+		))
+	}
+	telegram.SendToTelegramWithInlineKeyboard(h.bot, chatID, message.String(), tgbotapi.NewInlineKeyboardMarkup(keyboard...))
+}
@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/audit"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/utils"
+)
+
+func TestResolveProcessSkipsHiddenServers(t *testing.T) {
+	h, _, tg := newTestHandler(t)
+
+	other := addTestServer(t, h)
+	other.AddProcess(supervisortest.Process{Name: "web", State: "RUNNING", Pid: 4242})
+
+	config.Permissions = &permissions.Policy{
+		DefaultRole: permissions.RoleViewer,
+		Users: map[int64][]permissions.Grant{
+			2: {{Role: permissions.RoleViewer, Server: other.URL}},
+			3: {{Role: permissions.RoleNone}},
+		},
+	}
+
+	// Everyone else sees web on both servers and has to pick one
+	sendCommand(h, &tgbotapi.User{ID: 4}, "/status web")
+	if picks := tg.sent(testChatID, "Process found on several servers"); len(picks) != 1 {
+		t.Fatalf("got %d server choices for a user seeing both servers, want 1", len(picks))
+	}
+
+	// The server user 2 can't see is neither listed nor in the way
+	sendCommand(h, &tgbotapi.User{ID: 2}, "/status web")
+	if cards := tg.sent(testChatID, "*PID:* `4242`"); len(cards) != 1 {
+		t.Errorf("got %d cards of web on the other server for user 2, want 1", len(cards))
+	}
+	if picks := tg.sent(testChatID, "Process found on several servers"); len(picks) != 1 {
+		t.Errorf("user 2 was asked to pick among servers they can't see")
+	}
+
+	// Users who see nothing are told it doesn't exist
+	sendCommand(h, &tgbotapi.User{ID: 3}, "/status web")
+	if missing := tg.sent(testChatID, "Process `web` not found"); len(missing) != 1 {
+		t.Errorf("got %d not found replies for a user without access, want 1", len(missing))
+	}
+}
+
+func TestStopProcessOnlyTouchesItsServer(t *testing.T) {
+	h, server, _ := newTestHandler(t)
+	server.AddProcess(supervisortest.Process{Name: "web", Group: "workers", State: "RUNNING"})
+	other := addTestServer(t, h)
+
+	message := &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: 1, UserName: "alice"},
+		Chat:      &tgbotapi.Chat{ID: testChatID},
+	}
+	h.StopProcess(context.Background(), message, "workers:web")
+
+	if state := server.State("workers:web"); state != "STOPPED" {
+		t.Errorf("workers:web is %s, want STOPPED", state)
+	}
+	// Neither the ungrouped web of the same server nor the other server's
+	if state := server.State("web"); state != "RUNNING" {
+		t.Errorf("web is %s after stopping workers:web, want RUNNING", state)
+	}
+	for _, call := range other.Calls() {
+		if call == "supervisor.stopProcess" {
+			t.Errorf("stopping workers:web called %s on the other server", call)
+		}
+	}
+	entries, err := h.auditLog.Query(audit.Filter{})
+	if err != nil || len(entries) != 1 || entries[0].Target != "workers:web" {
+		t.Errorf("audit log = %+v, %v, want the stop of workers:web", entries, err)
+	}
+
+	// Viewers are refused like on the button
+	message.From = &tgbotapi.User{ID: 2}
+	h.StopProcess(context.Background(), message, "web@"+utils.GetShortServerId(other.URL))
+	if state := other.State("web"); state != "RUNNING" {
+		t.Errorf("web on the other server is %s after a viewer's stop, want RUNNING", state)
+	}
+}
+
+func TestStartIgnoresDeepLinkPayload(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	server.SetState("web", "STOPPED", 0)
+	operator := &tgbotapi.User{ID: 1, UserName: "alice"}
+
+	// Deep links arrive as "/start <payload>", which must not name a process
+	sendCommand(h, operator, "/start web")
+	if state := server.State("web"); state != "STOPPED" {
+		t.Errorf("web is %s after /start web, want STOPPED", state)
+	}
+	if overviews := tg.sent(testChatID, "Process Status Summary"); len(overviews) != 1 {
+		t.Errorf("got %d overviews for /start web, want 1", len(overviews))
+	}
+	if hints := tg.sent(testChatID, "/startproc web"); len(hints) != 1 {
+		t.Errorf("got %d hints for /start web, want 1", len(hints))
+	}
+
+	// Other payloads only get the overview
+	sendCommand(h, operator, "/start promo")
+	if hints := tg.sent(testChatID, "/startproc"); len(hints) != 1 {
+		t.Errorf("got %d hints after /start promo, want 1", len(hints))
+	}
+
+	sendCommand(h, operator, "/startproc web")
+	if state := server.State("web"); state != "RUNNING" {
+		t.Errorf("web is %s after /startproc web, want RUNNING", state)
+	}
+}
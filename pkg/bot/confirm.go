@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// pendingConfirmation is a destructive callback waiting for ✅ Confirm
+type pendingConfirmation struct {
+	callback telegram.Callback // the button that was pressed
+	userID   int64             // only the user who pressed the button may confirm
+	original *tgbotapi.Message
+	timer    *time.Timer
+}
+
+// destructiveAction describes a callback that needs confirmation
+type destructiveAction struct {
+	question  string // e.g. "Stop web on prod-1:9001?"
+	serverURL string
+	group     string // empty for server-wide actions
+}
+
+// parseDestructive returns the destructive action a callback performs, if any
+func parseDestructive(cb telegram.Callback) (destructiveAction, bool) {
+	verbs := map[string]string{
+		"stop":      "Stop",
+		"restart":   "Restart",
+		"signal":    "Send " + defaultSignal + " to",
+		"stopgroup": "Stop group",
+		"stopall":   "Stop all processes",
+		"signalall": "Send " + defaultSignal + " to all processes",
+	}
+	verb, ok := verbs[cb.Action]
+	if !ok {
+		return destructiveAction{}, false
+	}
+
+	switch cb.Action {
+	case "stopall", "signalall":
+		return destructiveAction{
+			question:  fmt.Sprintf("%s on %s?", verb, serverName(cb.ServerURL)),
+			serverURL: cb.ServerURL,
+		}, true
+	}
+
+	group := processGroup(cb.Target)
+	if cb.Action == "stopgroup" {
+		group = cb.Target
+	}
+	return destructiveAction{
+		question:  fmt.Sprintf("%s %s on %s?", verb, cb.Target, serverName(cb.ServerURL)),
+		serverURL: cb.ServerURL,
+		group:     group,
+	}, true
+}
+
+// serverName shortens a server URL to its host for prompts
+func serverName(serverURL string) string {
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return serverURL
+}
+
+// askConfirmation edits the message into a confirmation prompt for a
+// destructive callback. Unanswered prompts turn back into the original
+// message after CONFIRM_TIMEOUT.
+func (h *Handler) askConfirmation(query *tgbotapi.CallbackQuery, cb telegram.Callback, action destructiveAction) {
+	token, err := newConfirmToken()
+	if err != nil {
+		log.Printf("Error creating confirmation token: %v", err)
+		return
+	}
+
+	pending := &pendingConfirmation{callback: cb, userID: query.From.ID, original: query.Message}
+	h.mu.Lock()
+	pending.timer = time.AfterFunc(config.ConfirmTimeout, func() {
+		if h.takeConfirmation(token) != nil {
+			h.restoreMessage(pending.original)
+		}
+	})
+	h.confirmations[token] = pending
+	h.mu.Unlock()
+
+	message := telegram.FormatConfirmation(action.question, config.ConfirmTimeout)
+	h.editMessage(query.Message.Chat.ID, query.Message.MessageID, message, telegram.BuildConfirmationKeyboard(token))
+}
+
+// handleConfirmationCallback handles the ✅ Confirm and ❌ Cancel buttons,
+// whose target is the confirmation token
+func (h *Handler) handleConfirmationCallback(query *tgbotapi.CallbackQuery, cb telegram.Callback) {
+	token := cb.Target
+
+	h.mu.Lock()
+	pending, ok := h.confirmations[token]
+	if ok && pending.userID != query.From.ID {
+		h.mu.Unlock()
+		telegram.SendToTelegram(h.bot, query.Message.Chat.ID, "Only the user who pressed the button can confirm it\\.")
+		return
+	}
+	h.mu.Unlock()
+
+	if h.takeConfirmation(token) == nil {
+		// Timed out, the timer already restored the message
+		telegram.SendToTelegram(h.bot, query.Message.Chat.ID, "⌛ Confirmation expired, nothing was done\\.")
+		return
+	}
+	// Actions that report in a new message leave the original in place
+	h.restoreMessage(pending.original)
+	if cb.Action == "cancel" {
+		return
+	}
+
+	log.Printf("%s confirmed %s %s on %s", describeUser(query.From), pending.callback.Action, pending.callback.Target, pending.callback.ServerURL)
+	h.dispatchCallback(query, pending.callback)
+}
+
+// takeConfirmation removes a pending confirmation and stops its timer. It
+// returns nil when the token is unknown or already taken.
+func (h *Handler) takeConfirmation(token string) *pendingConfirmation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pending, ok := h.confirmations[token]
+	if !ok {
+		return nil
+	}
+	delete(h.confirmations, token)
+	pending.timer.Stop()
+	return pending
+}
+
+// restoreMessage edits a message back to its text, formatting and buttons
+// from before the confirmation prompt
+func (h *Handler) restoreMessage(original *tgbotapi.Message) {
+	editMsg := tgbotapi.NewEditMessageText(original.Chat.ID, original.MessageID, original.Text)
+	editMsg.Entities = original.Entities
+	editMsg.ReplyMarkup = original.ReplyMarkup
+	if _, err := h.bot.Send(editMsg); err != nil {
+		log.Printf("Error restoring message: %v", err)
+	}
+}
+
+// needsConfirmation reports whether destructive actions on a server must be
+// confirmed, which servers can turn off with skip_confirm
+func needsConfirmation(serverURL string) bool {
+	server, ok := config.ServerByURL(serverURL)
+	return !ok || !server.SkipConfirm
+}
+
+func newConfirmToken() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// confirmFirst asks for confirmation when the callback is destructive and the
+// server requires it, and reports whether it did. Users who may not run the
+// action are refused right away instead of being asked.
+func (h *Handler) confirmFirst(query *tgbotapi.CallbackQuery, cb telegram.Callback) bool {
+	action, ok := parseDestructive(cb)
+	if !ok || !needsConfirmation(action.serverURL) {
+		return false
+	}
+	if !h.permitted(query.Message.Chat.ID, query.From, permissions.ActionControl, action.serverURL, action.group) {
+		return true
+	}
+	h.askConfirmation(query, cb, action)
+	return true
+}
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+var (
+	alice = &tgbotapi.User{ID: 1, UserName: "alice"}
+	bob   = &tgbotapi.User{ID: 2, UserName: "bob"}
+)
+
+// newConfirmingTestHandler is newTestHandler with confirmations required
+func newConfirmingTestHandler(t *testing.T) (*Handler, *supervisortest.Server, *fakeTelegram) {
+	t.Helper()
+	h, server, tg := newTestHandler(t)
+	config.Servers = []config.ServerConfig{{URL: server.URL}}
+	return h, server, tg
+}
+
+// pressOnCard simulates a button press by user on a details card
+func pressOnCard(h *Handler, user *tgbotapi.User, callback telegram.Callback) {
+	h.handleCallbackQuery(&tgbotapi.CallbackQuery{
+		ID:   "1",
+		From: user,
+		Message: &tgbotapi.Message{
+			MessageID: 7,
+			Chat:      &tgbotapi.Chat{ID: testChatID},
+			Text:      "original card",
+		},
+		Data: telegram.EncodeCallback(callback),
+	})
+}
+
+// pendingToken returns the token of the only pending confirmation
+func pendingToken(t *testing.T, h *Handler) string {
+	t.Helper()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.confirmations) != 1 {
+		t.Fatalf("%d pending confirmations, want 1", len(h.confirmations))
+	}
+	for token := range h.confirmations {
+		return token
+	}
+	return ""
+}
+
+func pendingCount(h *Handler) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.confirmations)
+}
+
+func countCalls(server *supervisortest.Server, method string) int {
+	n := 0
+	for _, call := range server.Calls() {
+		if call == method {
+			n++
+		}
+	}
+	return n
+}
+
+func TestConfirmationPrompt(t *testing.T) {
+	h, server, tg := newConfirmingTestHandler(t)
+
+	pressOnCard(h, alice, telegram.Callback{Action: "stop", ServerURL: server.URL, Target: "web"})
+	if prompts := tg.sent(testChatID, "Stop web on"); len(prompts) != 1 || prompts[0].method != "editMessageText" {
+		t.Fatalf("prompts = %+v, want the card edited into one", prompts)
+	}
+	if countCalls(server, "supervisor.stopProcess") != 0 || server.State("web") != "RUNNING" {
+		t.Error("stopped before the confirmation")
+	}
+
+	// Starting is harmless and runs right away
+	server.SetState("web", "STOPPED", 0)
+	pressOnCard(h, alice, telegram.Callback{Action: "start", ServerURL: server.URL, Target: "web"})
+	if server.State("web") != "RUNNING" {
+		t.Error("start waited for a confirmation")
+	}
+}
+
+func TestConfirmRunsAction(t *testing.T) {
+	h, server, tg := newConfirmingTestHandler(t)
+
+	pressOnCard(h, alice, telegram.Callback{Action: "stop", ServerURL: server.URL, Target: "web"})
+	token := pendingToken(t, h)
+	pressOnCard(h, alice, telegram.Callback{Action: "confirm", Target: token})
+	if state := server.State("web"); state != "STOPPED" {
+		t.Errorf("web is %s after confirming, want STOPPED", state)
+	}
+	if restored := tg.sent(testChatID, "original card"); len(restored) != 1 {
+		t.Errorf("card restored %d times, want once", len(restored))
+	}
+	if n := pendingCount(h); n != 0 {
+		t.Errorf("%d confirmations still pending", n)
+	}
+
+	// A second press of the same Confirm does nothing
+	before := countCalls(server, "supervisor.stopProcess")
+	pressOnCard(h, alice, telegram.Callback{Action: "confirm", Target: token})
+	if countCalls(server, "supervisor.stopProcess") != before {
+		t.Error("a used confirmation ran the action again")
+	}
+	if expired := tg.sent(testChatID, "Confirmation expired"); len(expired) != 1 {
+		t.Errorf("got %d expiry notes, want 1", len(expired))
+	}
+}
+
+func TestConfirmByAnotherUser(t *testing.T) {
+	h, server, tg := newConfirmingTestHandler(t)
+
+	pressOnCard(h, alice, telegram.Callback{Action: "stop", ServerURL: server.URL, Target: "web"})
+	token := pendingToken(t, h)
+	pressOnCard(h, bob, telegram.Callback{Action: "confirm", Target: token})
+	if refusals := tg.sent(testChatID, "Only the user who pressed the button can confirm it"); len(refusals) != 1 {
+		t.Errorf("got %d refusals, want 1", len(refusals))
+	}
+	if state := server.State("web"); state != "RUNNING" {
+		t.Errorf("web is %s after another user confirmed, want RUNNING", state)
+	}
+
+	// The prompt is still there for the user who asked
+	pressOnCard(h, alice, telegram.Callback{Action: "confirm", Target: token})
+	if state := server.State("web"); state != "STOPPED" {
+		t.Errorf("web is %s after confirming, want STOPPED", state)
+	}
+}
+
+func TestCancelConfirmation(t *testing.T) {
+	h, server, tg := newConfirmingTestHandler(t)
+
+	pressOnCard(h, alice, telegram.Callback{Action: "stopall", ServerURL: server.URL})
+	pressOnCard(h, alice, telegram.Callback{Action: "cancel", Target: pendingToken(t, h)})
+	if countCalls(server, "supervisor.stopAllProcesses") != 0 || server.State("web") != "RUNNING" {
+		t.Error("cancel stopped the processes")
+	}
+	if restored := tg.sent(testChatID, "original card"); len(restored) != 1 {
+		t.Errorf("card restored %d times, want once", len(restored))
+	}
+	if n := pendingCount(h); n != 0 {
+		t.Errorf("%d confirmations pending after cancel", n)
+	}
+}
+
+func TestConfirmationTimeout(t *testing.T) {
+	timeout := config.ConfirmTimeout
+	config.ConfirmTimeout = 20 * time.Millisecond
+	defer func() { config.ConfirmTimeout = timeout }()
+	h, server, tg := newConfirmingTestHandler(t)
+
+	pressOnCard(h, alice, telegram.Callback{Action: "restart", ServerURL: server.URL, Target: "web"})
+	token := pendingToken(t, h)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(tg.sent(testChatID, "original card")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("card not restored after the timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := pendingCount(h); n != 0 {
+		t.Errorf("%d confirmations pending after the timeout", n)
+	}
+
+	pressOnCard(h, alice, telegram.Callback{Action: "confirm", Target: token})
+	if countCalls(server, "supervisor.stopProcess") != 0 {
+		t.Error("a timed out confirmation ran the restart")
+	}
+	if expired := tg.sent(testChatID, "Confirmation expired"); len(expired) != 1 {
+		t.Errorf("got %d expiry notes, want 1", len(expired))
+	}
+}
+
+func TestSkipConfirmIsPerServer(t *testing.T) {
+	h, server, _ := newConfirmingTestHandler(t)
+	staging := addTestServer(t, h)
+	config.Servers = []config.ServerConfig{{URL: server.URL}, {URL: staging.URL, SkipConfirm: true}}
+
+	pressOnCard(h, alice, telegram.Callback{Action: "stop", ServerURL: staging.URL, Target: "web"})
+	if state := staging.State("web"); state != "STOPPED" {
+		t.Errorf("web on the skip_confirm server is %s, want STOPPED right away", state)
+	}
+	pressOnCard(h, alice, telegram.Callback{Action: "stop", ServerURL: server.URL, Target: "web"})
+	if state := server.State("web"); state != "RUNNING" {
+		t.Errorf("web on the other server is %s, want RUNNING until confirmed", state)
+	}
+	if n := pendingCount(h); n != 1 {
+		t.Errorf("%d confirmations pending, want 1", n)
+	}
+}
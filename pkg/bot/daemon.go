@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// daemonStatus is what the bot last saw of one supervisord instance
+type daemonStatus struct {
+	Reachable      bool
+	Breaker        supervisor.BreakerState
+	State          string
+	PID            int
+	Version        string
+	Identification string
+	Since          time.Time // when the current PID was first seen
+	SinceExact     bool      // Since is the observed restart, not the bot's start
+}
+
+// Uptime returns how long supervisord has been up and whether that is exact
+// or only a lower bound (the daemon was already running when first seen)
+func (d *daemonStatus) Uptime() (time.Duration, bool) {
+	if d.Since.IsZero() {
+		return 0, false
+	}
+	return time.Since(d.Since), d.SinceExact
+}
+
+// daemonAlert is a supervisord alert waiting to be sent
+type daemonAlert struct {
+	title   string
+	details string
+}
+
+// checkDaemon compares a poll result with the last known state of the
+// server's supervisord and alerts on unreachability, state and PID changes.
+// With the circuit breaker enabled, reachability alerts are only sent when it
+// opens and closes, so a single failed poll on a flaky link stays quiet.
+func (h *Handler) checkDaemon(result serverProcesses) {
+	h.mu.Lock()
+	alerts := h.updateDaemon(result)
+	h.mu.Unlock()
+
+	// Sending can be slow, button presses must not wait on it for h.mu
+	for _, alert := range alerts {
+		h.sendDaemonAlert(result.serverURL, alert.title, alert.details)
+	}
+}
+
+// updateDaemon records a poll result and returns the alerts it calls for,
+// h.mu must be held
+func (h *Handler) updateDaemon(result serverProcesses) []daemonAlert {
+	var alerts []daemonAlert
+	serverURL := result.serverURL
+	prev, known := h.daemons[serverURL]
+	if !known {
+		prev = &daemonStatus{Reachable: true}
+	}
+
+	if config.BreakerThreshold > 0 {
+		if alert, ok := breakerAlert(prev.Breaker, result.breaker, result.err); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	if result.err != nil {
+		if prev.Reachable && config.BreakerThreshold <= 0 {
+			alerts = append(alerts, daemonAlert{"🔌 Supervisor unreachable", result.err.Error()})
+		}
+		prev.Reachable = false
+		prev.Breaker = result.breaker
+		h.daemons[serverURL] = prev
+		return alerts
+	}
+
+	current := &daemonStatus{
+		Reachable:      true,
+		Breaker:        result.breaker,
+		State:          result.state,
+		PID:            result.pid,
+		Version:        result.version,
+		Identification: result.identification,
+		Since:          time.Now(),
+	}
+	h.daemons[serverURL] = current
+
+	if !known {
+		return alerts
+	}
+	// Until a poll got through Since is unknown, the first one that does
+	// starts the lower bound
+	if !prev.Since.IsZero() {
+		current.Since, current.SinceExact = prev.Since, prev.SinceExact
+	}
+
+	if !prev.Reachable && config.BreakerThreshold <= 0 {
+		alerts = append(alerts, daemonAlert{"✅ Supervisor reachable again", fmt.Sprintf("State: %s", current.State)})
+	}
+	if prev.PID != 0 && prev.PID != current.PID {
+		// A new PID without us seeing it go down means a silent restart
+		current.Since, current.SinceExact = time.Now(), true
+		alerts = append(alerts, daemonAlert{"♻️ Supervisor restarted", fmt.Sprintf("PID %d → %d", prev.PID, current.PID)})
+	}
+	if prev.State != "" && prev.State != current.State {
+		alerts = append(alerts, daemonAlert{"⚠️ Supervisor state changed", fmt.Sprintf("%s → %s", prev.State, current.State)})
+	}
+	return alerts
+}
+
+// breakerAlert returns the alert for a server's circuit breaker opening or
+// closing again. A failed half-open probe is not a new outage.
+func breakerAlert(prev, current supervisor.BreakerState, err error) (daemonAlert, bool) {
+	switch {
+	case prev == supervisor.BreakerClosed && current == supervisor.BreakerOpen:
+		details := fmt.Sprintf("Calls are paused, probing every %s", config.BreakerOpenTimeout)
+		if err != nil {
+			details += "\n" + err.Error()
+		}
+		return daemonAlert{"🔴 Supervisor unreachable, circuit breaker open", details}, true
+	case prev != supervisor.BreakerClosed && current == supervisor.BreakerClosed:
+		return daemonAlert{"🟢 Supervisor reachable again, circuit breaker closed", "Calls resumed"}, true
+	}
+	return daemonAlert{}, false
+}
+
+// daemonStatus returns a copy of the last known supervisord status of a server
+func (h *Handler) daemonStatus(serverURL string) (daemonStatus, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status, ok := h.daemons[serverURL]
+	if !ok {
+		return daemonStatus{}, false
+	}
+	return *status, true
+}
+
+func (h *Handler) sendDaemonAlert(serverURL, title, details string) {
+	message := telegram.FormatDaemonAlert(serverURL, title, details)
+	if err := telegram.SendToTelegram(h.bot, config.TelegramChatID, message); err != nil {
+		log.Printf("Error sending supervisor alert to Telegram: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/state"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+)
+
+func TestDaemonFirstPollFails(t *testing.T) {
+	threshold := config.BreakerThreshold
+	config.BreakerThreshold = 0
+	defer func() { config.BreakerThreshold = threshold }()
+
+	h, server, tg := newStoredTestHandler(t, state.Discard{})
+	server.FailMethod("supervisor.getState", supervisor.FaultFailed, "FAILED")
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Supervisor unreachable"); len(alerts) != 1 {
+		t.Errorf("got %d unreachable alerts, want 1", len(alerts))
+	}
+	if status, _ := h.daemonStatus(server.URL); !status.Since.IsZero() {
+		t.Errorf("Since = %v before any poll got through, want zero", status.Since)
+	}
+
+	server.ClearFault("supervisor.getState")
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Supervisor reachable again"); len(alerts) != 1 {
+		t.Errorf("got %d reachable alerts, want 1", len(alerts))
+	}
+	status, _ := h.daemonStatus(server.URL)
+	if status.Since.IsZero() || status.SinceExact {
+		t.Errorf("Since = %v, exact %v after the first good poll, want a lower bound from now", status.Since, status.SinceExact)
+	}
+	first := status.Since
+
+	// Later polls keep the bound, a restart makes it exact
+	h.CheckProcessStatuses(context.Background())
+	if status, _ := h.daemonStatus(server.URL); !status.Since.Equal(first) {
+		t.Errorf("Since moved from %v to %v without a restart", first, status.Since)
+	}
+	server.Restart()
+	h.CheckProcessStatuses(context.Background())
+	if status, _ := h.daemonStatus(server.URL); !status.SinceExact {
+		t.Error("Since is not exact after a restart was seen")
+	}
+	if alerts := tg.sent(testChatID, "Supervisor restarted"); len(alerts) != 1 {
+		t.Errorf("got %d restart alerts, want 1", len(alerts))
+	}
+}
@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// handleDaemonLogCallback handles the supervisord main log callbacks: "dlog"
+// shows the page its arguments point at, "dlogclear" asks to clear the log
+// and "dlogclearok" clears it
+func (h *Handler) handleDaemonLogCallback(ctx context.Context, chatID int64, messageID int, user *tgbotapi.User, cb telegram.Callback) {
+	serverURL := cb.ServerURL
+	switch cb.Action {
+	case "dlogclear", "dlogclearok":
+		if !h.permitted(chatID, user, permissions.ActionAdmin, serverURL, "") {
+			return
+		}
+		if cb.Action == "dlogclear" {
+			h.editMessage(chatID, messageID, telegram.FormatDaemonLogClearConfirm(serverURL), telegram.BuildDaemonLogClearKeyboard(serverURL))
+			return
+		}
+
+		log.Printf("User %d clears the supervisord log on %s", user.ID, serverURL)
+		err := h.supervisorClients[serverURL].ClearLog(ctx)
+		h.recordAction(chatID, user, serverURL, "", "clearlog", err)
+		if err != nil {
+			telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("clearing the supervisord log", serverURL, err))
+			return
+		}
+		h.showDaemonLog(ctx, chatID, messageID, user, serverURL, 0, false)
+
+	case "dlog":
+		back, err := strconv.ParseInt(cb.Arg(0), 10, 64)
+		if err != nil || back < 0 {
+			return
+		}
+		if !h.permitted(chatID, user, permissions.ActionView, serverURL, "") {
+			return
+		}
+		h.showDaemonLog(ctx, chatID, messageID, user, serverURL, back, cb.Arg(1) == "after")
+	}
+}
+
+// showDaemonLog edits a message into a page of the supervisord main log that
+// ends back bytes before the end of the log (0 for the latest output), or
+// starts there when after is set. Pages are addressed from the end, so they
+// shift when the log grows between clicks.
+func (h *Handler) showDaemonLog(ctx context.Context, chatID int64, messageID int, user *tgbotapi.User, serverURL string, back int64, after bool) {
+	client := h.supervisorClients[serverURL]
+	pageBytes := int64(config.LogPageBytes)
+	if back <= 0 {
+		back, after = 0, false
+	}
+
+	var data string
+	var start, end, size int64
+	var err error
+	if back == 0 {
+		// readLog reads from a negative offset to the end, which is just the
+		// latest page. One byte more than needed tells whether older output
+		// exists, offsets count from the start of what was read.
+		data, err = client.ReadLog(ctx, -(pageBytes + 1), 0)
+		size = int64(len(data))
+		start, end = max(size-pageBytes, 0), size
+		data = data[start:]
+	} else {
+		// Older pages are read at absolute offsets, a negative offset would
+		// read everything up to the end
+		size, err = client.LogSize(ctx)
+		if err == nil {
+			if after {
+				start = max(size-back, 0)
+				end = min(start+pageBytes, size)
+			} else {
+				end = max(size-back, 0)
+				start = max(end-pageBytes, 0)
+			}
+			// A zero length reads to the end
+			if end > start {
+				data, err = client.ReadLog(ctx, start, end-start)
+			}
+		}
+	}
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("reading the supervisord log", serverURL, err))
+		return
+	}
+	text, shownStart, shownEnd := trimLogWindow(data, start, config.LogTailLines, after, end == size)
+
+	olderBack := int64(-1)
+	if shownStart > 0 {
+		olderBack = size - shownStart
+	}
+	newerBack := int64(-1)
+	if shownEnd < size {
+		newerBack = size - shownEnd
+	}
+
+	message := telegram.FormatDaemonLog(serverURL, text, size-shownStart, size-shownEnd)
+	canClear := roleFor(user, serverURL, "").Can(permissions.ActionAdmin)
+	keyboard := telegram.BuildDaemonLogKeyboard(serverURL, olderBack, newerBack, canClear)
+	h.editMessage(chatID, messageID, message, keyboard)
+}
+
+func (h *Handler) editMessage(chatID int64, messageID int, message string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, message, keyboard)
+	editMsg.ParseMode = "MarkdownV2"
+	if _, err := h.bot.Send(editMsg); err != nil {
+		log.Printf("Error updating message: %v", err)
+	}
+}
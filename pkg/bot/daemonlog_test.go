@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/audit"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// logAdmin may clear the supervisord log, user 1 is only an operator
+var logAdmin = &tgbotapi.User{ID: 3, UserName: "carol"}
+
+func TestDaemonLogPages(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	lines := config.LogTailLines
+	t.Cleanup(func() { config.LogTailLines = lines })
+	config.LogTailLines = 2
+	server.AppendDaemonLog("one\ntwo\nthree\nfour\nfive\nsix\n")
+
+	viewer := &tgbotapi.User{ID: 4}
+	pressAs(h, viewer, telegram.DaemonLogCallback(server.URL, 0, false))
+	pages := tg.sent(testChatID, "supervisord log:")
+	if len(pages) != 1 || !strings.Contains(pages[0].text, "five\nsix\n```") || strings.Contains(pages[0].text, "four") {
+		t.Fatalf("latest page = %+v, want the last two lines", pages)
+	}
+	if !strings.Contains(pages[0].markup, "Older") || strings.Contains(pages[0].markup, "Clear") {
+		t.Errorf("latest page buttons = %s, want Older and no Clear for a viewer", pages[0].markup)
+	}
+
+	// Older pages are addressed by bytes back from the end
+	pressAs(h, viewer, telegram.DaemonLogCallback(server.URL, int64(len("five\nsix\n")), false))
+	pages = tg.sent(testChatID, "supervisord log:")
+	if len(pages) != 2 || !strings.Contains(pages[1].text, "three\nfour\n```") {
+		t.Errorf("older page = %+v, want lines three and four", pages[1:])
+	}
+
+	// The oldest page has nothing older, going newer retraces the way back
+	back := int64(len("three\nfour\nfive\nsix\n"))
+	pressAs(h, viewer, telegram.DaemonLogCallback(server.URL, back, false))
+	pressAs(h, viewer, telegram.DaemonLogCallback(server.URL, back, true))
+	pages = tg.sent(testChatID, "supervisord log:")
+	if len(pages) != 4 || !strings.Contains(pages[2].text, "one\ntwo\n```") || strings.Contains(pages[2].markup, "Older") {
+		t.Errorf("oldest page = %+v, want lines one and two without Older", pages[2:])
+	}
+	if len(pages) == 4 && (!strings.Contains(pages[3].text, "three\nfour\n```") || !strings.Contains(pages[3].markup, "Newer")) {
+		t.Errorf("newer page = %+v, want lines three and four with Newer", pages[3])
+	}
+}
+
+func TestClearDaemonLog(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	config.Permissions = &permissions.Policy{
+		DefaultRole: permissions.RoleViewer,
+		Admins:      []int64{logAdmin.ID},
+		Users:       map[int64][]permissions.Grant{1: {{Role: permissions.RoleOperator}}},
+	}
+	server.AppendDaemonLog("INFO spawned: 'web'\n")
+
+	pressAs(h, logAdmin, telegram.DaemonLogCallback(server.URL, 0, false))
+	if pages := tg.sent(testChatID, "spawned"); len(pages) != 1 || !strings.Contains(pages[0].markup, "Clear") {
+		t.Errorf("admin's page = %+v, want a Clear button", pages)
+	}
+
+	// Clearing asks first
+	pressAs(h, logAdmin, telegram.Callback{Action: "dlogclear", ServerURL: server.URL})
+	if prompts := tg.sent(testChatID, "Clear the supervisord log?"); len(prompts) != 1 {
+		t.Errorf("got %d clear prompts, want 1", len(prompts))
+	}
+	if server.DaemonLog() == "" {
+		t.Fatal("the log was cleared before confirming")
+	}
+
+	// Operators can neither ask nor confirm
+	operator := &tgbotapi.User{ID: 1, UserName: "alice"}
+	pressAs(h, operator, telegram.Callback{Action: "dlogclear", ServerURL: server.URL})
+	pressAs(h, operator, telegram.Callback{Action: "dlogclearok", ServerURL: server.URL})
+	if refusals := tg.sent(testChatID, "⛔ Your role `operator` can't"); len(refusals) != 2 {
+		t.Errorf("got %d refusals for an operator, want 2", len(refusals))
+	}
+	if server.DaemonLog() == "" {
+		t.Fatal("an operator cleared the log")
+	}
+
+	pressAs(h, logAdmin, telegram.Callback{Action: "dlogclearok", ServerURL: server.URL})
+	if log := server.DaemonLog(); log != "" {
+		t.Errorf("log after clearing = %q", log)
+	}
+	if pages := tg.sent(testChatID, "(empty)"); len(pages) != 1 {
+		t.Errorf("got %d empty log pages after clearing, want 1", len(pages))
+	}
+	entries, _ := h.auditLog.Query(audit.Filter{User: "@carol"})
+	if len(entries) != 1 || entries[0].Action != "clearlog" || entries[0].Result != "ok" {
+		t.Errorf("audit entries = %+v, want the clear recorded", entries)
+	}
+}
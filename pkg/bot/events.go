@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/eventlistener"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// maxOutputBytes caps the log output forwarded from one PROCESS_LOG_* event
+const maxOutputBytes = 3000
+
+// HandleEvent feeds a supervisord event into the same alerting path polling uses
+func (h *Handler) HandleEvent(ctx context.Context, event eventlistener.Event) {
+	if _, ok := h.supervisorClients[event.ServerURL]; !ok {
+		log.Printf("Error handling %s event: unknown server %q, check EVENTS_SERVER_URL of its listener", event.Name, event.ServerURL)
+		return
+	}
+
+	switch {
+	case event.IsProcessState():
+		h.handleStateEvent(ctx, event)
+	case event.IsProcessLog():
+		h.sendProcessOutput(event)
+	}
+	h.saveState()
+}
+
+func (h *Handler) handleStateEvent(ctx context.Context, event eventlistener.Event) {
+	process := h.eventProcess(ctx, event)
+	processKey := event.ServerURL + ":" + process.FullName()
+	state := event.State()
+
+	// Keep the polling view in sync so the same change is not alerted twice.
+	// A poll that saw the change first has alerted on it already.
+	prev, seen := h.recordStatus(processKey, state)
+	polled := seen && prev == state
+
+	switch {
+	case state == "RUNNING":
+		h.stopFlapping(processKey)
+		h.seenRunning(event.ServerURL, process.FullName())
+
+	case state == "BACKOFF":
+		// Polling usually misses these, alert once per streak of failed starts
+		if !h.startFlapping(processKey) || polled {
+			return
+		}
+		h.sendStatusAlert(event.ServerURL, process)
+
+	case state == "FATAL":
+		if polled {
+			return
+		}
+		h.sendStatusAlert(event.ServerURL, process)
+
+	case event.Payload["from_state"] == "RUNNING":
+		// A poll that saw the process leave RUNNING first has alerted or
+		// taken the user-stopped flag then
+		if (seen && prev != "RUNNING") || h.takeUserStopped(processKey) {
+			return
+		}
+		h.sendStatusAlert(event.ServerURL, process)
+	}
+}
+
+// startFlapping marks a process as failing to start and reports whether it
+// was not marked yet
+func (h *Handler) startFlapping(processKey string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.flapping[processKey]; ok {
+		return false
+	}
+	h.flapping[processKey] = struct{}{}
+	return true
+}
+
+// stopFlapping drops the mark of startFlapping once the process runs
+func (h *Handler) stopFlapping(processKey string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.flapping, processKey)
+}
+
+// eventProcess returns the full process info, or what the event payload
+// tells about the process when the server can't be asked
+func (h *Handler) eventProcess(ctx context.Context, event eventlistener.Event) models.Process {
+	process := models.Process{
+		Name:        event.ProcessName(),
+		Group:       event.GroupName(),
+		State:       event.State(),
+		ServerURL:   event.ServerURL,
+		Description: "Reported by event " + event.Name,
+	}
+	process.Pid, _ = strconv.Atoi(event.Payload["pid"])
+
+	info, err := h.supervisorClients[event.ServerURL].GetProcessInfo(ctx, process.FullName())
+	if err != nil {
+		log.Printf("Error getting process info from %s: %v", event.ServerURL, err)
+		return process
+	}
+	info.ServerURL = event.ServerURL
+	// The event is authoritative, the process may have moved on since
+	info.State = process.State
+	return info
+}
+
+// sendProcessOutput forwards the output carried by a PROCESS_LOG_* event,
+// unless the process is muted
+func (h *Handler) sendProcessOutput(event eventlistener.Event) {
+	processName := models.Process{Name: event.ProcessName(), Group: event.GroupName()}.FullName()
+	if h.muted(event.ServerURL, processName) {
+		return
+	}
+	data := event.Data
+	if len(data) > maxOutputBytes {
+		data = data[len(data)-maxOutputBytes:]
+	}
+	message := telegram.FormatProcessOutput(event.ServerURL, processName, event.Stream(), data)
+	if err := telegram.SendToTelegram(h.bot, config.TelegramChatID, message); err != nil {
+		log.Printf("Error sending process output to Telegram: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/eventlistener"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// stateEvent is the PROCESS_STATE_<state> event of web on serverURL
+func stateEvent(serverURL, state, fromState string) eventlistener.Event {
+	return eventlistener.Event{
+		ServerURL: serverURL,
+		Name:      "PROCESS_STATE_" + state,
+		Payload:   map[string]string{"processname": "web", "groupname": "web", "from_state": fromState},
+	}
+}
+
+func TestEventAlertsStateChange(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+
+	server.SetState("web", "EXITED", 1)
+	h.HandleEvent(context.Background(), stateEvent(server.URL, "EXITED", "RUNNING"))
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 1 {
+		t.Fatalf("got %d alerts for the event, want 1", len(alerts))
+	}
+
+	// The poll after the event sees nothing new
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 1 {
+		t.Errorf("got %d alerts after the poll, want 1", len(alerts))
+	}
+}
+
+func TestEventAfterPollIsNotAlertedAgain(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+	}{
+		{name: "exited", state: "EXITED"},
+		{name: "fatal", state: "FATAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, server, tg := newTestHandler(t)
+
+			server.SetState("web", tt.state, 1)
+			h.CheckProcessStatuses(context.Background())
+			h.HandleEvent(context.Background(), stateEvent(server.URL, tt.state, "RUNNING"))
+			if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 1 {
+				t.Errorf("got %d alerts, want 1", len(alerts))
+			}
+		})
+	}
+}
+
+func TestEventAfterPollOfUserStop(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+
+	// The poll takes the user-stopped flag before the STOPPING event arrives
+	press(h, telegram.Callback{Action: "stop", ServerURL: server.URL, Target: "web"})
+	h.CheckProcessStatuses(context.Background())
+	h.HandleEvent(context.Background(), stateEvent(server.URL, "STOPPING", "RUNNING"))
+	h.HandleEvent(context.Background(), stateEvent(server.URL, "STOPPED", "STOPPING"))
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 0 {
+		t.Fatalf("got %d alerts for a stop from the bot, want none", len(alerts))
+	}
+
+	// A later crash is still alerted
+	press(h, telegram.Callback{Action: "start", ServerURL: server.URL, Target: "web"})
+	h.HandleEvent(context.Background(), stateEvent(server.URL, "RUNNING", "STARTING"))
+	server.SetState("web", "EXITED", 1)
+	h.HandleEvent(context.Background(), stateEvent(server.URL, "EXITED", "RUNNING"))
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 1 {
+		t.Errorf("got %d alerts for a crash after the stop, want 1", len(alerts))
+	}
+}
+
+func TestEventFromUnknownServerIsDropped(t *testing.T) {
+	h, _, tg := newTestHandler(t)
+
+	h.HandleEvent(context.Background(), stateEvent("web1", "FATAL", "BACKOFF"))
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 0 {
+		t.Errorf("got %d alerts for an unknown server, want none", len(alerts))
+	}
+}
+
+func TestMutedProcessOutputIsDropped(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	output := eventlistener.Event{
+		ServerURL: server.URL,
+		Name:      "PROCESS_LOG_STDERR",
+		Payload:   map[string]string{"processname": "web", "groupname": "web", "channel": "stderr"},
+		Data:      "panic: boom\n",
+	}
+
+	h.HandleEvent(context.Background(), output)
+	if sent := tg.sent(testChatID, "Process Output"); len(sent) != 1 {
+		t.Fatalf("got %d output messages, want 1", len(sent))
+	}
+
+	press(h, telegram.Callback{Action: "mute", ServerURL: server.URL, Target: "web", Args: []string{"1h"}})
+	h.HandleEvent(context.Background(), output)
+	if sent := tg.sent(testChatID, "Process Output"); len(sent) != 1 {
+		t.Errorf("got %d output messages while muted, want 1", len(sent))
+	}
+}
@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/utils"
+)
+
+// processQuery is a parsed /find query such as "web state=FATAL,BACKOFF".
+// Every part given must match.
+type processQuery struct {
+	states  []string       // upper-case states, any when empty
+	servers []string       // server URLs, short IDs or hosts, any when empty
+	text    string         // lower-case substring of the name, group or description
+	pattern *regexp.Regexp // set instead of text for "/regex/"
+}
+
+// parseProcessQuery parses "state=" and "server=" filters, each taking a comma
+// separated list, and free text. Text written as /regex/ is matched as a case
+// insensitive regular expression.
+func parseProcessQuery(query string) (processQuery, error) {
+	var q processQuery
+	var words []string
+	for _, field := range strings.Fields(query) {
+		key, value, ok := strings.Cut(field, "=")
+		switch {
+		case ok && strings.EqualFold(key, "state"):
+			for _, state := range strings.Split(value, ",") {
+				if state != "" {
+					q.states = append(q.states, strings.ToUpper(state))
+				}
+			}
+		case ok && strings.EqualFold(key, "server"):
+			for _, server := range strings.Split(value, ",") {
+				if server != "" {
+					q.servers = append(q.servers, server)
+				}
+			}
+		default:
+			words = append(words, field)
+		}
+	}
+
+	text := strings.Join(words, " ")
+	if len(text) >= 2 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/") {
+		pattern, err := regexp.Compile("(?i)" + text[1:len(text)-1])
+		if err != nil {
+			return processQuery{}, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		q.pattern = pattern
+		return q, nil
+	}
+	q.text = strings.ToLower(text)
+	return q, nil
+}
+
+// matchesServer reports whether the query includes processes of serverURL
+func (q processQuery) matchesServer(serverURL string) bool {
+	if len(q.servers) == 0 {
+		return true
+	}
+	for _, server := range q.servers {
+		if server == serverURL || server == utils.GetShortServerId(serverURL) || server == serverName(serverURL) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q processQuery) matches(process models.Process) bool {
+	if len(q.states) > 0 && !contains(q.states, process.State) {
+		return false
+	}
+	fields := []string{process.FullName(), process.Description}
+	if q.pattern != nil {
+		for _, field := range fields {
+			if q.pattern.MatchString(field) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), q.text) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindProcesses answers /find with the first page of matching processes
+func (h *Handler) FindProcesses(ctx context.Context, chatID int64, user *tgbotapi.User, query string) {
+	h.showSearchResults(ctx, chatID, 0, user, query, 1)
+}
+
+// showSearchResults shows a page of the processes matching query that the
+// user may view. It edits the message with messageID, or sends a new message
+// when messageID is 0.
+func (h *Handler) showSearchResults(ctx context.Context, chatID int64, messageID int, user *tgbotapi.User, query string, page int) {
+	q, err := parseProcessQuery(query)
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, "❌ "+telegram.EscapeMarkdownV2(err.Error()))
+		return
+	}
+
+	var found []models.Process
+	var failed []string
+	for _, server := range h.fetchAllProcesses(ctx) {
+		if !q.matchesServer(server.serverURL) {
+			continue
+		}
+		if server.err != nil {
+			log.Printf("Error getting processes from %s: %v", server.serverURL, server.err)
+			failed = append(failed, server.serverURL)
+			continue
+		}
+		for _, process := range server.processes {
+			process.ServerURL = server.serverURL
+			if q.matches(process) && roleFor(user, process.ServerURL, process.Group).Can(permissions.ActionView) {
+				found = append(found, process)
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].ServerURL != found[j].ServerURL {
+			return found[i].ServerURL < found[j].ServerURL
+		}
+		return found[i].FullName() < found[j].FullName()
+	})
+
+	totalPages := (len(found) + config.ProcessesPerPage - 1) / config.ProcessesPerPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
+	page = max(1, min(page, totalPages))
+	start := (page - 1) * config.ProcessesPerPage
+	end := min(start+config.ProcessesPerPage, len(found))
+
+	message := telegram.FormatSearchResults(query, found[start:end], len(found), page, totalPages)
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		message += fmt.Sprintf("\n⚠️ Not searched, unreachable: `%s`", telegram.EscapeMarkdownV2(strings.Join(failed, ", ")))
+	}
+	keyboard := telegram.BuildPaginatedKeyboard(found, page, func(page int) telegram.Callback {
+		return telegram.FindCallback(query, page)
+	})
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+		telegram.CallbackButton("🗂 All processes", telegram.Callback{Action: "show_all"}),
+	))
+
+	if messageID == 0 {
+		telegram.SendToTelegramWithInlineKeyboard(h.bot, chatID, message, keyboard)
+		return
+	}
+	h.editMessage(chatID, messageID, message, keyboard)
+}
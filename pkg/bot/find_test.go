@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+func TestParseProcessQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		states  string
+		servers string
+		text    string
+		pattern string
+		wantErr string
+	}{
+		{query: ""},
+		{query: "Web API", text: "web api"},
+		{query: "state=fatal,Backoff", states: "FATAL,BACKOFF"},
+		{query: "STATE=exited,", states: "EXITED"},
+		{query: "server=web1,abc123 worker", servers: "web1,abc123", text: "worker"},
+		{query: "/^web_\\d+$/ state=running", states: "RUNNING", pattern: "(?i)^web_\\d+$"},
+		{query: "/a b/", pattern: "(?i)a b"},
+		{query: "/", text: "/"},
+		{query: "name=web", text: "name=web"},
+		{query: "/[/", wantErr: "invalid regular expression"},
+	}
+	for _, tt := range tests {
+		q, err := parseProcessQuery(tt.query)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseProcessQuery(%q) error = %v, want %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseProcessQuery(%q) error = %v", tt.query, err)
+			continue
+		}
+		pattern := ""
+		if q.pattern != nil {
+			pattern = q.pattern.String()
+		}
+		if got := strings.Join(q.states, ","); got != tt.states {
+			t.Errorf("parseProcessQuery(%q) states = %q, want %q", tt.query, got, tt.states)
+		}
+		if got := strings.Join(q.servers, ","); got != tt.servers {
+			t.Errorf("parseProcessQuery(%q) servers = %q, want %q", tt.query, got, tt.servers)
+		}
+		if q.text != tt.text || pattern != tt.pattern {
+			t.Errorf("parseProcessQuery(%q) = text %q, pattern %q, want %q, %q", tt.query, q.text, pattern, tt.text, tt.pattern)
+		}
+	}
+}
+
+func TestProcessQueryMatches(t *testing.T) {
+	web := models.Process{Name: "web_01", Group: "web", State: "RUNNING", Description: "pid 42, uptime 1:00:00"}
+	worker := models.Process{Name: "worker", Group: "worker", State: "FATAL", Description: "Exited too quickly"}
+
+	tests := []struct {
+		query string
+		want  string // names of the matching processes
+	}{
+		{query: "", want: "web_01,worker"},
+		{query: "WEB", want: "web_01"},
+		{query: "web:", want: "web_01"},
+		{query: "quickly", want: "worker"},
+		{query: "state=fatal", want: "worker"},
+		{query: "web state=fatal", want: ""},
+		{query: "/^w.*r$/", want: "worker"},
+		{query: "/^WEB:web_\\d+$/", want: "web_01"},
+	}
+	for _, tt := range tests {
+		q, err := parseProcessQuery(tt.query)
+		if err != nil {
+			t.Fatalf("parseProcessQuery(%q): %v", tt.query, err)
+		}
+		var names []string
+		for _, process := range []models.Process{web, worker} {
+			if q.matches(process) {
+				names = append(names, process.Name)
+			}
+		}
+		if got := strings.Join(names, ","); got != tt.want {
+			t.Errorf("%q matches %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestProcessQueryMatchesServer(t *testing.T) {
+	q, err := parseProcessQuery("server=web1.example.com:9001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.matchesServer("http://web1.example.com:9001/RPC2") {
+		t.Error("host:port does not match its server URL")
+	}
+	if q.matchesServer("http://web2.example.com:9001/RPC2") {
+		t.Error("matched another server")
+	}
+
+	q, _ = parseProcessQuery("web")
+	if !q.matchesServer("http://anything:9001/RPC2") {
+		t.Error("a query without servers must match every server")
+	}
+}
+
+func TestAllProcessesOverview(t *testing.T) {
+	h, _, tg := newTestHandler(t)
+
+	sendCommand(h, &tgbotapi.User{ID: 2}, "/find")
+	results := tg.sent(testChatID, "")
+	if len(results) != 1 || !strings.Contains(results[0].markup, "All processes") {
+		t.Fatalf("/find results = %+v, want an All processes button", results)
+	}
+
+	// Control buttons only for users who may use them
+	pressAs(h, &tgbotapi.User{ID: 2}, telegram.Callback{Action: "show_all"})
+	press(h, telegram.Callback{Action: "show_all"})
+	overviews := tg.sent(testChatID, "All Processes Status")
+	if len(overviews) != 2 {
+		t.Fatalf("got %d overviews, want 2", len(overviews))
+	}
+	if strings.Contains(overviews[0].markup, "🛑") || !strings.Contains(overviews[0].markup, "web") {
+		t.Errorf("viewer's overview buttons = %s, want web without 🛑", overviews[0].markup)
+	}
+	if !strings.Contains(overviews[1].markup, "🛑") {
+		t.Errorf("operator's overview buttons = %s, want 🛑", overviews[1].markup)
+	}
+}
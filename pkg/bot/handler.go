@@ -1,37 +1,79 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"net/url"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/k0kubun/pp"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/audit"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/logger"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/state"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
-	"github.com/rarebek/supervisor-tg-notifier/pkg/utils"
 )
 
 var processPath string
 
+// defaultSignal is sent by the signal buttons
+const defaultSignal = "HUP"
+
 type Handler struct {
-	bot                  *tgbotapi.BotAPI
-	supervisorClients    map[string]*supervisor.Client
-	userStoppedProcesses map[string]struct{}
-	previousStatus       map[string]string
+	bot               *tgbotapi.BotAPI
+	supervisorClients map[string]supervisor.ProcessManager
+	subscriptions     *subscriptionStore
+	auditLog          *audit.Log // nil when AUDIT_FILE is empty
+	store             state.Store
+
+	saveMu         sync.Mutex // serializes saves from the monitor loop and the updates goroutine
+	savedAt        time.Time
+	savedCallbacks uint64 // telegram.CallbacksVersion of the last save
+
+	mu                   sync.Mutex                      // guards the fields below
+	userStoppedProcesses map[string]struct{}             // processes stopped through the bot by process key
+	previousStatus       map[string]string               // last seen state by process key
+	daemons              map[string]*daemonStatus        // last seen supervisord status per server
+	rejected             map[int64]time.Time             // last admin notification per rejected user
+	confirmations        map[string]*pendingConfirmation // destructive callbacks by confirmation token
+	mutes                map[string]models.Mute          // silenced alerts by process key
+	flapping             map[string]struct{}             // processes alerted for BACKOFF until RUNNING again
+	changed              bool                            // statuses, stop flags or mutes changed since the last save
 }
 
-func NewHandler(bot *tgbotapi.BotAPI, supervisorClients map[string]*supervisor.Client) *Handler {
+// NewHandler creates a handler that persists its monitor state in store.
+// Call RestoreState before polling to pick up where the last run left off.
+func NewHandler(bot *tgbotapi.BotAPI, supervisorClients map[string]supervisor.ProcessManager, store state.Store) *Handler {
+	var auditLog *audit.Log
+	if config.AuditFile != "" {
+		var err error
+		auditLog, err = audit.Open(config.AuditFile)
+		if err != nil {
+			log.Fatalf("Error opening audit log: %v", err)
+		}
+	}
+
 	return &Handler{
 		bot:                  bot,
 		supervisorClients:    supervisorClients,
 		userStoppedProcesses: make(map[string]struct{}),
 		previousStatus:       make(map[string]string),
+		flapping:             make(map[string]struct{}),
+		subscriptions:        newSubscriptionStore(),
+		store:                store,
+		auditLog:             auditLog,
+		daemons:              make(map[string]*daemonStatus),
+		rejected:             make(map[int64]time.Time),
+		confirmations:        make(map[string]*pendingConfirmation),
+		mutes:                make(map[string]models.Mute),
 	}
 }
 
@@ -45,169 +87,392 @@ func (h *Handler) HandleUpdates() {
 
 	// Process updates in infinite loop
 	for update := range updates {
-		// Handle callback queries (button clicks)
-		if update.CallbackQuery != nil {
-			h.handleCallbackQuery(update.CallbackQuery)
-			continue
-		}
+		h.handleUpdate(update)
+	}
+}
 
-		// Handle text messages
-		if update.Message == nil {
-			continue
+// handleUpdate acts on one update, rejecting senders that are not allowed
+// before anything else
+func (h *Handler) handleUpdate(update tgbotapi.Update) {
+	// Handle callback queries (button clicks)
+	if query := update.CallbackQuery; query != nil {
+		if query.Message == nil || !isAllowed(query.From, query.Message.Chat.ID) {
+			h.rejectCallback(query)
+			return
 		}
-		h.handleMessage(update.Message)
+		h.handleCallbackQuery(query)
+		return
+	}
+
+	// Handle text messages
+	if update.Message == nil {
+		return
+	}
+	if !isAllowed(update.Message.From, update.Message.Chat.ID) {
+		h.rejectUpdate(update.Message.From, update.Message.Chat, "message")
+		return
 	}
+	h.handleMessage(update.Message)
 }
 
 func (h *Handler) handleCallbackQuery(query *tgbotapi.CallbackQuery) {
-	data := query.Data
+	answer := ""
+	cb, ok := telegram.DecodeCallback(query.Data)
+	if !ok {
+		// Expired buttons, and those of a run that had no STATE_FILE
+		answer = "⌛ This button has expired, send /start for a fresh menu"
+	} else if _, known := h.supervisorClients[cb.ServerURL]; cb.ServerURL != "" && !known {
+		log.Printf("Ignoring callback %q for unknown server %s", cb.Action, cb.ServerURL)
+	} else if cb.Action == "confirm" || cb.Action == "cancel" {
+		h.handleConfirmationCallback(query, cb)
+	} else if !h.confirmFirst(query, cb) {
+		h.dispatchCallback(query, cb)
+	}
+
+	// Always acknowledge the callback
+	callback := tgbotapi.NewCallback(query.ID, answer)
+	if _, err := h.bot.Request(callback); err != nil {
+		log.Printf("Error acknowledging callback: %v", err)
+	}
+}
+
+// dispatchCallback runs the action of a button press. Destructive actions
+// arrive here only once confirmed, or for servers that skip confirmation.
+func (h *Handler) dispatchCallback(query *tgbotapi.CallbackQuery, cb telegram.Callback) {
 	chatID := query.Message.Chat.ID
 	messageID := query.Message.MessageID
+	serverURL := cb.ServerURL
+	ctx := context.Background()
 
-	switch {
-	case strings.HasPrefix(data, "details_"):
-		trimmedData := strings.TrimPrefix(data, "details_")
-		parts := strings.Split(trimmedData, "_")
-		if len(parts) >= 2 {
-			// Last part is always the server ID
-			serverID := parts[len(parts)-1]
-			// All parts except last one form the process name
-			processName := strings.Join(parts[:len(parts)-1], "_")
-
-			// Find server URL from ID
-			serverURL, _ := url.QueryUnescape(serverID)
-			if client, ok := h.supervisorClients[serverURL]; ok {
-				processes, err := client.GetAllProcesses()
-				if err != nil {
-					log.Printf("Error getting process info: %v", err)
-					return
-				}
+	switch cb.Action {
+	case "details":
+		h.refreshProcessDetails(ctx, chatID, messageID, query.From, serverURL, cb.Target)
 
-				for _, process := range processes {
-					if process.Name == processName {
-						process.ServerURL = serverURL
-						message := telegram.FormatProcessDetails(process)
-						keyboard := telegram.BuildProcessControlKeyboard(process.Name, serverURL)
-
-						editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, message, keyboard)
-						editMsg.ParseMode = "MarkdownV2"
-
-						if _, err := h.bot.Send(editMsg); err != nil {
-							log.Printf("Error updating message: %v", err)
-						}
-						break
-					}
-				}
+	case "start", "stop", "restart", "signal":
+		processName := cb.Target
+		if !h.permitted(chatID, query.From, permissions.ActionControl, serverURL, processGroup(processName)) {
+			break
+		}
+		client := h.supervisorClients[serverURL]
+
+		var err error
+		switch cb.Action {
+		case "start":
+			err = client.StartProcess(ctx, processName)
+			if err == nil {
+				// A mark left by a stop that no tick saw must not hide the next crash
+				h.takeUserStopped(serverURL + ":" + processName)
 			}
+		case "stop":
+			// Set user-stopped flag before stopping, drop it if nothing stopped
+			processKey := serverURL + ":" + processName
+			h.markUserStopped(processKey)
+			err = client.StopProcess(ctx, processName)
+			if err != nil {
+				h.takeUserStopped(processKey)
+			}
+		case "restart":
+			// A restart passes through STOPPED on purpose, don't alert on it.
+			// The flag is dropped afterwards in case no tick saw the stop.
+			processKey := serverURL + ":" + processName
+			h.markUserStopped(processKey)
+			err = client.RestartProcess(ctx, processName)
+			h.takeUserStopped(processKey)
+		case "signal":
+			err = client.SignalProcess(ctx, processName, defaultSignal)
+		}
+		h.recordAction(chatID, query.From, serverURL, processName, cb.Action, err)
+		if err != nil {
+			telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("running "+cb.Action+" on "+processName, serverURL, err))
+			break
 		}
+		// Get updated process details from only this server
+		h.refreshProcessDetails(ctx, chatID, messageID, query.From, serverURL, processName)
 
-	case strings.HasPrefix(data, "start_"), strings.HasPrefix(data, "stop_"):
-		// Remove the prefix (start_ or stop_)
-		trimmedData := strings.TrimPrefix(data, strings.Split(data, "_")[0]+"_")
-		// Find the last underscore to split process name and server ID
-		lastUnderscoreIndex := strings.LastIndex(trimmedData, "_")
-		if lastUnderscoreIndex != -1 {
-			processName := trimmedData[:lastUnderscoreIndex]
-			shortID := trimmedData[lastUnderscoreIndex+1:]
-
-			// Find the full server URL from short ID
-			var serverURL string
-			for url := range h.supervisorClients {
-				if utils.GetShortServerId(url) == shortID {
-					serverURL = url
-					break
-				}
+	case "startgroup", "stopgroup":
+		groupName := cb.Target
+		if !h.permitted(chatID, query.From, permissions.ActionControl, serverURL, groupName) {
+			break
+		}
+		client := h.supervisorClients[serverURL]
+
+		var err error
+		done := "started"
+		if cb.Action == "startgroup" {
+			err = client.StartProcessGroup(ctx, groupName)
+			if err == nil {
+				h.clearGroupUserStopped(serverURL, groupName)
 			}
-			pp.Println("serverURL in control: ", serverURL)
-
-			if serverURL != "" {
-				if client, ok := h.supervisorClients[serverURL]; ok {
-					switch {
-					case strings.HasPrefix(data, "start_"):
-						pp.Println(data)
-						if err := client.StartProcess(processName); err != nil {
-							telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("Error starting process: `%s`", telegram.EscapeMarkdownV2(err.Error())))
-							return
-						}
-						processes, _ := client.GetAllProcesses()
-						for _, process := range processes {
-							if process.Name == processName {
-								process.ServerURL = serverURL
-								message := telegram.FormatProcessDetails(process)
-								keyboard := telegram.BuildProcessControlKeyboard(process.Name, serverURL)
-
-								editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, message, keyboard)
-								editMsg.ParseMode = "MarkdownV2"
-								h.bot.Send(editMsg)
-								break
-							}
-						}
-
-					case strings.HasPrefix(data, "stop_"):
-						// Set user-stopped flag before stopping
-						processKey := serverURL + ":" + processName
-						h.userStoppedProcesses[processKey] = struct{}{}
-
-						if err := client.StopProcess(processName); err != nil {
-							telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("Error stopping process: `%s`", telegram.EscapeMarkdownV2(err.Error())))
-							return
-						}
-						// Get updated process details from only this server
-						processes, _ := client.GetAllProcesses()
-						for _, process := range processes {
-							if process.Name == processName {
-								process.ServerURL = serverURL
-								message := telegram.FormatProcessDetails(process)
-								keyboard := telegram.BuildProcessControlKeyboard(process.Name, serverURL)
-								editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, message, keyboard)
-								editMsg.ParseMode = "MarkdownV2"
-								h.bot.Send(editMsg)
-								break
-							}
-						}
-					}
-				}
+		} else {
+			marked := h.markGroupUserStopped(ctx, serverURL, groupName)
+			err = client.StopProcessGroup(ctx, groupName)
+			if err != nil {
+				h.unmarkUserStopped(marked)
 			}
+			done = "stopped"
 		}
+		h.recordAction(chatID, query.From, serverURL, groupName, cb.Action, err)
+		if err != nil {
+			telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("running "+cb.Action+" on "+groupName, serverURL, err))
+			break
+		}
+		telegram.SendTargetStatusMessage(h.bot, chatID, "Group", groupName, done)
+
+	case "find":
+		page, err := strconv.Atoi(cb.Arg(0))
+		if err != nil {
+			break
+		}
+		h.showSearchResults(ctx, chatID, messageID, query.From, cb.Target, page)
+
+	case "show_all":
+		h.RefreshAllProcesses(ctx, chatID, messageID, query.From)
+
+	case "audit":
+		offset, err := strconv.Atoi(cb.Arg(0))
+		if err != nil {
+			break
+		}
+		h.showAuditPage(chatID, messageID, query.From, cb.Target, offset, cb.Arg(1) == "after")
+
+	case "mute":
+		h.handleMuteCallback(chatID, query.From, cb)
+
+	case "unmute":
+		h.handleUnmuteCallback(chatID, messageID, query.From, cb)
+
+	case "subs", "sub":
+		h.handleSubscriptionCallback(ctx, chatID, messageID, query.From, cb)
+
+	case "reload":
+		h.handleReloadCallback(ctx, chatID, query.From, serverURL)
+
+	case "config":
+		if !h.permitted(chatID, query.From, permissions.ActionView, serverURL, processGroup(cb.Target)) {
+			break
+		}
+		h.showProcessConfig(ctx, chatID, messageID, serverURL, cb.Target)
+
+	case "dlog", "dlogclear", "dlogclearok":
+		h.handleDaemonLogCallback(ctx, chatID, messageID, query.From, cb)
+
+	case "log":
+		h.handleLogCallback(ctx, chatID, messageID, query.From, cb)
+
+	case "server":
+		if !h.permitted(chatID, query.From, permissions.ActionView, serverURL, "") {
+			break
+		}
+		keyboard := telegram.BuildServerControlKeyboard(serverURL, roleFor(query.From, serverURL, ""))
+		editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, telegram.FormatServerControls(serverURL), keyboard)
+		editMsg.ParseMode = "MarkdownV2"
+		if _, err := h.bot.Send(editMsg); err != nil {
+			log.Printf("Error updating message: %v", err)
+		}
+
+	case "startall", "stopall", "signalall":
+		if !h.permitted(chatID, query.From, permissions.ActionControl, serverURL, "") {
+			break
+		}
+		client := h.supervisorClients[serverURL]
+
+		var err error
+		var done string
+		switch cb.Action {
+		case "startall":
+			err = client.StartAllProcesses(ctx)
+			if err == nil {
+				h.clearGroupUserStopped(serverURL, "")
+			}
+			done = "started all processes"
+		case "stopall":
+			marked := h.markGroupUserStopped(ctx, serverURL, "")
+			err = client.StopAllProcesses(ctx)
+			if err != nil {
+				h.unmarkUserStopped(marked)
+			}
+			done = "stopped all processes"
+		case "signalall":
+			err = client.SignalAllProcesses(ctx, defaultSignal)
+			done = "signalled all processes"
+		}
+		h.recordAction(chatID, query.From, serverURL, "", cb.Action, err)
+		if err != nil {
+			telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("running "+cb.Action, serverURL, err))
+			break
+		}
+		telegram.SendTargetStatusMessage(h.bot, chatID, "Server", serverURL, done)
 	}
+}
 
-	// Always acknowledge the callback
-	callback := tgbotapi.NewCallback(query.ID, "")
-	if _, err := h.bot.Request(callback); err != nil {
-		log.Printf("Error acknowledging callback: %v", err)
+// refreshProcessDetails edits a message into the current details card of a process
+func (h *Handler) refreshProcessDetails(ctx context.Context, chatID int64, messageID int, user *tgbotapi.User, serverURL, processName string) {
+	process, err := h.getProcess(ctx, serverURL, processName)
+	if err != nil {
+		log.Printf("Error getting process info: %v", err)
+		telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("getting process info", serverURL, err))
+		return
+	}
+	if !h.permitted(chatID, user, permissions.ActionView, serverURL, process.Group) {
+		return
+	}
+
+	message := telegram.FormatProcessDetails(process)
+	keyboard := telegram.BuildProcessControlKeyboard(process, roleFor(user, serverURL, process.Group), roleFor(user, serverURL, ""))
+
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, message, keyboard)
+	editMsg.ParseMode = "MarkdownV2"
+
+	if _, err := h.bot.Send(editMsg); err != nil {
+		log.Printf("Error updating message: %v", err)
+	}
+}
+
+// getProcess fetches one process of a server. Plain names of grouped
+// processes are unknown to getProcessInfo, those fall back to the full list.
+func (h *Handler) getProcess(ctx context.Context, serverURL, processName string) (models.Process, error) {
+	client := h.supervisorClients[serverURL]
+	process, err := client.GetProcessInfo(ctx, processName)
+	if err == nil {
+		process.ServerURL = serverURL
+		return process, nil
+	}
+	if !supervisor.IsFault(err, supervisor.FaultBadName) {
+		return models.Process{}, err
+	}
+
+	processes, err := client.GetAllProcesses(ctx)
+	if err != nil {
+		return models.Process{}, err
+	}
+	for _, process := range processes {
+		if process.Matches(processName) {
+			process.ServerURL = serverURL
+			return process, nil
+		}
+	}
+	return models.Process{}, fmt.Errorf("process %s not found", processName)
+}
+
+// markGroupUserStopped flags the running processes of a group (or of the
+// whole server when groupName is empty) as stopped on purpose so no failure
+// alert is sent, and returns the keys it flagged. Idle processes are left
+// alone, a stop does not touch them and the flag would hide their next crash.
+func (h *Handler) markGroupUserStopped(ctx context.Context, serverURL, groupName string) []string {
+	processes, err := h.supervisorClients[serverURL].GetAllProcesses(ctx)
+	if err != nil {
+		log.Printf("Error getting processes from %s: %v", serverURL, err)
+		return nil
+	}
+	var marked []string
+	for _, process := range processes {
+		if groupName != "" && process.Group != groupName {
+			continue
+		}
+		if process.State != "RUNNING" && process.State != "STARTING" {
+			continue
+		}
+		processKey := serverURL + ":" + process.FullName()
+		h.markUserStopped(processKey)
+		marked = append(marked, processKey)
+	}
+	return marked
+}
+
+// unmarkUserStopped drops the flags of a stop that failed
+func (h *Handler) unmarkUserStopped(processKeys []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, processKey := range processKeys {
+		delete(h.userStoppedProcesses, processKey)
+	}
+	h.changed = true
+}
+
+// clearGroupUserStopped drops the flags of a group (or of the whole server
+// when groupName is empty) once it was started again
+func (h *Handler) clearGroupUserStopped(serverURL, groupName string) {
+	prefix := serverURL + ":"
+	if groupName != "" {
+		prefix += groupName
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for processKey := range h.userStoppedProcesses {
+		if !strings.HasPrefix(processKey, prefix) {
+			continue
+		}
+		// "group" and "group:name" belong to the group, "groupother" does not
+		rest := processKey[len(prefix):]
+		if groupName == "" || rest == "" || rest[0] == ':' {
+			delete(h.userStoppedProcesses, processKey)
+			h.changed = true
+		}
 	}
 }
 
+// markUserStopped flags a process as stopped on purpose, so leaving RUNNING
+// is not alerted
+func (h *Handler) markUserStopped(processKey string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.userStoppedProcesses[processKey] = struct{}{}
+	h.changed = true
+}
+
+// takeUserStopped drops the flag of markUserStopped and reports whether it
+// was set
+func (h *Handler) takeUserStopped(processKey string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.userStoppedProcesses[processKey]
+	delete(h.userStoppedProcesses, processKey)
+	h.changed = h.changed || ok
+	return ok
+}
+
+// recordStatus stores the state a process was seen in and returns the one
+// seen before, if any
+func (h *Handler) recordStatus(processKey, status string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prev, exists := h.previousStatus[processKey]
+	h.previousStatus[processKey] = status
+	h.changed = h.changed || !exists || prev != status
+	return prev, exists
+}
+
 func (h *Handler) handleMessage(message *tgbotapi.Message) {
 	text := message.Text
 	chatID := message.Chat.ID
+	ctx := context.Background()
 
 	switch {
 	case strings.HasPrefix(text, "View "):
 		processName := strings.TrimPrefix(text, "View ")
 		processName = strings.ReplaceAll(processName, "\\_", "_") // Unescape underscores
-		h.ShowProcessDetails(chatID, processName)
+		h.ShowProcessDetails(ctx, chatID, message.From, processName)
 
-	case text == "/start" || text == "/help":
-		h.ShowAllProcesses(chatID)
+	case message.IsCommand():
+		h.runCommand(ctx, message)
 
 	default:
-		telegram.SendToTelegram(h.bot, chatID, "Unknown command. Use /start or /help to see available commands.")
+		telegram.SendToTelegram(h.bot, chatID, "Unknown command\\. Send /help to see the available commands\\.")
 	}
 }
 
-func (h *Handler) ShowProcessDetails(chatID int64, processName string) {
+func (h *Handler) ShowProcessDetails(ctx context.Context, chatID int64, user *tgbotapi.User, processName string) {
 	var foundProcesses []models.Process
 
 	for serverURL, client := range h.supervisorClients {
-		processes, err := client.GetAllProcesses()
+		processes, err := client.GetAllProcesses(ctx)
 		if err != nil {
 			log.Printf("Error getting process info from %s: %v", serverURL, err)
 			continue
 		}
 
 		for _, process := range processes {
-			if process.Name == processName {
+			if process.Matches(processName) && roleFor(user, serverURL, process.Group).Can(permissions.ActionView) {
 				process.ServerURL = serverURL
 				foundProcesses = append(foundProcesses, process)
 			}
@@ -222,7 +487,7 @@ func (h *Handler) ShowProcessDetails(chatID int64, processName string) {
 	if len(foundProcesses) == 1 {
 		process := foundProcesses[0]
 		message := telegram.FormatProcessDetails(process)
-		keyboard := telegram.BuildProcessControlKeyboard(process.Name, process.ServerURL)
+		keyboard := telegram.BuildProcessControlKeyboard(process, roleFor(user, process.ServerURL, process.Group), roleFor(user, process.ServerURL, ""))
 		telegram.SendToTelegramWithInlineKeyboard(h.bot, chatID, message, keyboard)
 		return
 	}
@@ -237,9 +502,9 @@ func (h *Handler) ShowProcessDetails(chatID int64, processName string) {
 		message.WriteString(fmt.Sprintf("• Server: `%s`\n  Status: `%s`\n\n", serverName, process.State))
 
 		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
+			telegram.CallbackButton(
 				fmt.Sprintf("View on %s", serverName),
-				fmt.Sprintf("details_%s_%s", telegram.EscapeMarkdownV2(process.Name), url.QueryEscape(process.ServerURL)),
+				telegram.DetailsCallback(process.FullName(), process.ServerURL),
 			),
 		))
 	}
@@ -247,52 +512,68 @@ func (h *Handler) ShowProcessDetails(chatID int64, processName string) {
 	telegram.SendToTelegramWithInlineKeyboard(h.bot, chatID, message.String(), tgbotapi.NewInlineKeyboardMarkup(keyboard...))
 }
 
-func (h *Handler) StartProcess(chatID int64, processPath string) {
-	// Split group:process if present
-	parts := strings.Split(processPath, ":")
-	processName := processPath
-	if len(parts) == 2 {
-		// Use group:process format for supervisor
-		processName = parts[0] + ":" + parts[1]
-	}
+// StartProcess starts a process given as "name[@server]" on the one server
+// that has it, through the same role check, confirmation and audit record as
+// the 🚀 Start button
+func (h *Handler) StartProcess(ctx context.Context, message *tgbotapi.Message, target string) {
+	h.runProcessCommand(ctx, message, target, "start")
+}
 
-	for _, client := range h.supervisorClients {
-		err := client.StartProcess(processName)
-		if err != nil {
-			log.Printf("Error starting process %s: %v", processName, err)
-			continue
-		}
-		err = telegram.SendStatusMessage(h.bot, chatID, processPath, "started")
-		if err != nil {
-			log.Printf("Error sending start process message to Telegram: %v", err)
-		}
-	}
+// StopProcess stops a process given as "name[@server]" on the one server that
+// has it, through the same role check, confirmation and audit record as the
+// 🛑 Stop button
+func (h *Handler) StopProcess(ctx context.Context, message *tgbotapi.Message, target string) {
+	h.runProcessCommand(ctx, message, target, "stop")
 }
 
-func (h *Handler) StopProcess(chatID int64, processPath string) {
-	// Split group:process if present
-	parts := strings.Split(processPath, ":")
-	processName := processPath
-	if len(parts) == 2 {
-		processName = parts[1] // Use just process name for actual stop
+// serverProcesses is the result of fetching the process list of one server
+type serverProcesses struct {
+	serverURL      string
+	state          string // supervisord state
+	pid            int    // supervisord PID
+	version        string
+	identification string
+	breaker        supervisor.BreakerState // breaker state after the call
+	processes      []models.Process
+	err            error
+}
+
+// fetchAllProcesses queries every server in parallel so that a slow or hung
+// server only delays the results by its own call timeout
+func (h *Handler) fetchAllProcesses(ctx context.Context) []serverProcesses {
+	results := make(chan serverProcesses, len(h.supervisorClients))
+	for serverURL, client := range h.supervisorClients {
+		go func(serverURL string, client supervisor.ProcessManager) {
+			snapshot, err := client.GetSnapshot(ctx, false)
+			results <- serverProcesses{
+				serverURL:      serverURL,
+				state:          snapshot.State,
+				pid:            snapshot.PID,
+				version:        snapshot.Version,
+				identification: snapshot.Identification,
+				breaker:        client.BreakerState(),
+				processes:      snapshot.Processes,
+				err:            err,
+			}
+		}(serverURL, client)
 	}
 
-	for _, client := range h.supervisorClients {
-		err := client.StopProcess(processName)
-		if err != nil {
-			log.Printf("Error stopping process %s: %v", processName, err)
-			continue
-		}
-		err = telegram.SendStatusMessage(h.bot, chatID, processPath, "stopped")
-		if err != nil {
-			log.Printf("Error sending stop process message to Telegram: %v", err)
-		}
+	all := make([]serverProcesses, 0, len(h.supervisorClients))
+	for range h.supervisorClients {
+		all = append(all, <-results)
 	}
+	return all
 }
 
-func (h *Handler) CheckProcessStatuses() {
-	for clientURL, client := range h.supervisorClients {
-		processes, err := client.GetAllProcesses()
+func (h *Handler) CheckProcessStatuses(ctx context.Context) {
+	for _, result := range h.fetchAllProcesses(ctx) {
+		h.checkDaemon(result)
+
+		clientURL, processes, err := result.serverURL, result.processes, result.err
+		if errors.Is(err, supervisor.ErrBreakerOpen) {
+			// Already alerted when the breaker opened, don't log every tick
+			continue
+		}
 		if err != nil {
 			log.Printf("Error getting processes from %s: %v", clientURL, err)
 			continue
@@ -300,69 +581,84 @@ func (h *Handler) CheckProcessStatuses() {
 
 		for _, process := range processes {
 			logger.Log("debug", "Process", process.Name, "on", clientURL, ":", process.State)
-			processKey := clientURL + ":" + process.Name
-			prev, exists := h.previousStatus[processKey]
-
-			// Store initial status if not exists
+			processKey := clientURL + ":" + process.FullName()
+			// Store the status for the next check, the first one only sets it
+			prev, exists := h.recordStatus(processKey, process.State)
+			if process.State == "RUNNING" {
+				h.seenRunning(clientURL, process.FullName())
+			}
 			if !exists {
-				h.previousStatus[processKey] = process.State
 				continue
 			}
 
-			// Check for status change from RUNNING to non-RUNNING
-			if prev == "RUNNING" && process.State != "RUNNING" {
-				// Check if it was stopped by user
-				if _, isUserStopped := h.userStoppedProcesses[processKey]; !isUserStopped {
-					// Only notify if not user-stopped
-					message := "*Processes Status:*\n"
-					message += fmt.Sprintf("*Server:* `%s`\n", telegram.EscapeMarkdownV2(clientURL))
-					message += telegram.FormatProcessStatusChange(process)
-					keyboard := [][]tgbotapi.InlineKeyboardButton{
-						tgbotapi.NewInlineKeyboardRow(
-							tgbotapi.NewInlineKeyboardButtonData(
-								"🚀 Start",
-								fmt.Sprintf("start_%s_%s", process.Name, url.QueryEscape(clientURL)),
-							),
-							tgbotapi.NewInlineKeyboardButtonData(
-								"🛑 Stop",
-								fmt.Sprintf("stop_%s_%s", process.Name, url.QueryEscape(clientURL)),
-							),
-						),
-					}
-					markup := tgbotapi.NewInlineKeyboardMarkup(keyboard...)
-					if err := telegram.SendToTelegramWithInlineKeyboard(h.bot, config.TelegramChatID, message, markup); err != nil {
-						log.Printf("Error sending notification to Telegram: %v", err)
-					}
-				} else {
-					// Clear user-stopped flag since status changed
-					delete(h.userStoppedProcesses, processKey)
-				}
+			// Check for status change from RUNNING to non-RUNNING. Only
+			// notify if not user-stopped, the flag is cleared either way.
+			if prev == "RUNNING" && process.State != "RUNNING" && !h.takeUserStopped(processKey) {
+				h.sendStatusAlert(clientURL, process)
 			}
-
-			// Update status for next check
-			h.previousStatus[processKey] = process.State
 		}
 	}
+	h.saveState()
 }
 
-func (h *Handler) ShowAllProcesses(chatID int64) {
+// sendStatusAlert notifies the main chat and the process's subscribers that
+// a process left RUNNING or failed, unless its alerts are muted
+func (h *Handler) sendStatusAlert(serverURL string, process models.Process) {
+	if h.muted(serverURL, process.FullName()) {
+		log.Printf("Alert for %s on %s muted: %s", process.FullName(), serverURL, process.State)
+		return
+	}
+
+	message := "*Processes Status:*\n"
+	message += fmt.Sprintf("*Server:* `%s`\n", telegram.EscapeMarkdownV2(serverURL))
+	message += telegram.FormatProcessStatusChange(process)
+	// The main chat is shared, its alerts keep every button and each press
+	// is checked against the role of whoever pressed it
+	markup := telegram.BuildAlertKeyboard(serverURL, process.FullName(), permissions.RoleAdmin)
+	if err := telegram.SendToTelegramWithInlineKeyboard(h.bot, config.TelegramChatID, message, markup); err != nil {
+		log.Printf("Error sending notification to Telegram: %v", err)
+	}
+	h.notifySubscribers(serverURL, process, message)
+}
+
+// canView reports whether the user may see a server and group. A nil user
+// stands for the main chat, which gets every alert anyway.
+func canView(user *tgbotapi.User, serverURL, group string) bool {
+	return user == nil || roleFor(user, serverURL, group).Can(permissions.ActionView)
+}
+
+// ShowAllProcesses sends the status summary of the servers and processes the
+// user may view, with a reply keyboard opening each process. user is nil for
+// the summary sent to the main chat at startup.
+func (h *Handler) ShowAllProcesses(ctx context.Context, chatID int64, user *tgbotapi.User) {
 	var summary strings.Builder
 	summary.WriteString("*Process Status Summary*\n\n")
 
 	var keyboard [][]tgbotapi.KeyboardButton
 
 	for clientID, client := range h.supervisorClients {
-		clientProcesses, err := client.GetAllProcesses()
+		snapshot, err := client.GetSnapshot(ctx, false)
 		if err != nil {
 			log.Printf("Error getting all processes from %s: %v", clientID, err)
-			message := fmt.Sprintf("Error fetching processes from %s: `%s`", clientID, telegram.EscapeMarkdownV2(err.Error()))
+			if !canView(user, clientID, "") {
+				continue
+			}
+			message := telegram.FormatClientError("fetching processes", clientID, err)
 			telegram.SendToTelegram(h.bot, chatID, message)
+			summary.WriteString(fmt.Sprintf("*Client: %s*\n%s\n\n", telegram.EscapeMarkdownV2(clientID), telegram.FormatBreakerState(client.BreakerState())))
 			continue
 		}
 
-		// Set ServerURL for each process
-		for i := range clientProcesses {
-			clientProcesses[i].ServerURL = clientID
+		// Set ServerURL for each process, leaving out those the user can't see
+		var clientProcesses []models.Process
+		for _, process := range snapshot.Processes {
+			if canView(user, clientID, process.Group) {
+				process.ServerURL = clientID
+				clientProcesses = append(clientProcesses, process)
+			}
+		}
+		if len(clientProcesses) == 0 && !canView(user, clientID, "") {
+			continue
 		}
 
 		// Group by group name first
@@ -377,6 +673,12 @@ func (h *Handler) ShowAllProcesses(chatID int64) {
 		}
 
 		summary.WriteString(fmt.Sprintf("*Client: %s*\n", telegram.EscapeMarkdownV2(clientID)))
+		var uptime time.Duration
+		var exact bool
+		if status, ok := h.daemonStatus(clientID); ok && status.PID == snapshot.PID {
+			uptime, exact = status.Uptime()
+		}
+		summary.WriteString(telegram.FormatDaemonHeader(snapshot, uptime, exact, client.BreakerState()))
 
 		// Process each group
 		for groupName, groupProcesses := range processByGroup {
@@ -421,22 +723,28 @@ func (h *Handler) ShowAllProcesses(chatID int64) {
 	}
 }
 
-func (h *Handler) RefreshAllProcesses(chatID int64, messageID int) {
+// RefreshAllProcesses edits a message into the list of processes the user may
+// view, with control buttons where the user's role allows them
+func (h *Handler) RefreshAllProcesses(ctx context.Context, chatID int64, messageID int, user *tgbotapi.User) {
 	var processes []models.Process
 
 	for serverURL, client := range h.supervisorClients {
-		clientProcesses, err := client.GetAllProcesses()
+		clientProcesses, err := client.GetAllProcesses(ctx)
 		if err != nil {
 			log.Printf("Error getting all processes: %v", err)
-			message := fmt.Sprintf("Error fetching processes: `%s`", telegram.EscapeMarkdownV2(err.Error()))
-			telegram.SendToTelegram(h.bot, chatID, message)
+			if canView(user, serverURL, "") {
+				message := telegram.FormatClientError("fetching processes", serverURL, err)
+				telegram.SendToTelegram(h.bot, chatID, message)
+			}
 			continue
 		}
-		// Set ServerURL for each process
-		for i := range clientProcesses {
-			clientProcesses[i].ServerURL = serverURL
+		// Set ServerURL for each process the user can see
+		for _, process := range clientProcesses {
+			if roleFor(user, serverURL, process.Group).Can(permissions.ActionView) {
+				process.ServerURL = serverURL
+				processes = append(processes, process)
+			}
 		}
-		processes = append(processes, clientProcesses...)
 	}
 
 	sort.Slice(processes, func(i, j int) bool {
@@ -466,7 +774,9 @@ func (h *Handler) RefreshAllProcesses(chatID int64, messageID int) {
 	summary.WriteString("\n")
 
 	message := summary.String() + telegram.FormatAllProcessesList(processes)
-	keyboard := telegram.BuildAllProcessesKeyboard(processes)
+	keyboard := telegram.BuildAllProcessesKeyboard(processes, func(process models.Process) permissions.Role {
+		return roleFor(user, process.ServerURL, process.Group)
+	})
 
 	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, message)
 	editMsg.ParseMode = "MarkdownV2"
@@ -0,0 +1,370 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/audit"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/logger"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/state"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+const testChatID = 100
+
+func TestMain(m *testing.M) {
+	// Polling writes debug logs, keep them out of the source tree. The
+	// logger cleans up in the background, so the folder is set only once.
+	logFolder, err := os.MkdirTemp("", "bot-test-logs")
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger.LogFolder = logFolder
+	code := m.Run()
+	os.RemoveAll(logFolder)
+	os.Exit(code)
+}
+
+// sentMessage is a message the bot sent or edited through the fake Bot API
+type sentMessage struct {
+	method string
+	chatID int64
+	text   string
+	markup string // reply_markup JSON, empty without buttons
+}
+
+// fakeTelegram answers Bot API calls and records the messages sent
+type fakeTelegram struct {
+	mu       sync.Mutex
+	messages []sentMessage
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if method == "sendMessage" || method == "editMessageText" || method == "answerCallbackQuery" {
+		chatID, _ := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+		f.mu.Lock()
+		f.messages = append(f.messages, sentMessage{method: method, chatID: chatID, text: r.FormValue("text"), markup: r.FormValue("reply_markup")})
+		f.mu.Unlock()
+	}
+	// Good enough for getMe, sent messages and acknowledged callbacks alike
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot","message_id":1,"chat":{"id":1}}}`))
+}
+
+// sent returns the messages sent to chatID that contain text
+func (f *fakeTelegram) sent(chatID int64, text string) []sentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var matches []sentMessage
+	for _, message := range f.messages {
+		if message.chatID == chatID && strings.Contains(message.text, text) {
+			matches = append(matches, message)
+		}
+	}
+	return matches
+}
+
+// newTestHandler runs a handler against a fake supervisord with one RUNNING
+// process "web" and a fake Bot API, after a first poll
+func newTestHandler(t *testing.T) (*Handler, *supervisortest.Server, *fakeTelegram) {
+	t.Helper()
+	handler, server, tg := newStoredTestHandler(t, state.Discard{})
+	// The first poll only records the initial states
+	handler.CheckProcessStatuses(context.Background())
+	return handler, server, tg
+}
+
+// newStoredTestHandler is newTestHandler keeping its state in store, before
+// any poll
+func newStoredTestHandler(t *testing.T, store state.Store) (*Handler, *supervisortest.Server, *fakeTelegram) {
+	t.Helper()
+
+	server := supervisortest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddProcess(supervisortest.Process{Name: "web", State: "RUNNING"})
+
+	tg := &fakeTelegram{}
+	api := httptest.NewServer(tg)
+	t.Cleanup(api.Close)
+	bot, err := tgbotapi.NewBotAPIWithClient("token", api.URL+"/bot%s/%s", api.Client())
+	if err != nil {
+		t.Fatalf("NewBotAPIWithClient: %v", err)
+	}
+
+	client, err := supervisor.NewClient(server.URL, supervisor.Options{})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(client.Close)
+
+	chatID, auditFile, servers, policy := config.TelegramChatID, config.AuditFile, config.Servers, config.Permissions
+	t.Cleanup(func() {
+		config.TelegramChatID, config.AuditFile, config.Servers, config.Permissions = chatID, auditFile, servers, policy
+	})
+	config.TelegramChatID = testChatID
+	config.AuditFile = filepath.Join(t.TempDir(), "audit.jsonl")
+	config.Servers = []config.ServerConfig{{URL: server.URL, SkipConfirm: true}}
+	// press acts as user 1, an operator, everyone else only views
+	config.Permissions = &permissions.Policy{
+		DefaultRole: permissions.RoleViewer,
+		Users:       map[int64][]permissions.Grant{1: {{Role: permissions.RoleOperator}}},
+	}
+
+	handler := NewHandler(bot, map[string]supervisor.ProcessManager{server.URL: client}, store)
+	return handler, server, tg
+}
+
+// addTestServer connects h to another fake supervisord with a RUNNING "web"
+func addTestServer(t *testing.T, h *Handler) *supervisortest.Server {
+	t.Helper()
+	server := supervisortest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddProcess(supervisortest.Process{Name: "web", State: "RUNNING"})
+	client, err := supervisor.NewClient(server.URL, supervisor.Options{})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(client.Close)
+	h.supervisorClients[server.URL] = client
+	return server
+}
+
+// press simulates a button press by user 1 in the main chat
+func press(h *Handler, callback telegram.Callback) {
+	pressAs(h, &tgbotapi.User{ID: 1, UserName: "alice"}, callback)
+}
+
+// pressAs simulates a button press by user in the main chat
+func pressAs(h *Handler, user *tgbotapi.User, callback telegram.Callback) {
+	h.handleCallbackQuery(&tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    user,
+		Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: testChatID}},
+		Data:    telegram.EncodeCallback(callback),
+	})
+}
+
+// sendCommand simulates a command sent by user in the main chat, e.g. "/status web"
+func sendCommand(h *Handler, user *tgbotapi.User, text string) {
+	name, _, _ := strings.Cut(text, " ")
+	h.handleMessage(&tgbotapi.Message{
+		MessageID: 1,
+		From:      user,
+		Chat:      &tgbotapi.Chat{ID: testChatID},
+		Text:      text,
+		Entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(name)}},
+	})
+}
+
+func TestAlertOnStateChange(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 0 {
+		t.Fatalf("first poll sent %d alerts, want none", len(alerts))
+	}
+
+	server.SetState("web", "EXITED", 1)
+	h.CheckProcessStatuses(context.Background())
+
+	alerts := tg.sent(testChatID, "Process Status Change")
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	if !strings.Contains(alerts[0].text, "`web`") || !strings.Contains(alerts[0].text, "`EXITED`") {
+		t.Errorf("alert = %q, want web and EXITED", alerts[0].text)
+	}
+
+	// The same state is not alerted again
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 1 {
+		t.Errorf("got %d alerts after another poll, want 1", len(alerts))
+	}
+}
+
+func TestUserStopIsNotAlerted(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+
+	press(h, telegram.Callback{Action: "stop", ServerURL: server.URL, Target: "web"})
+	if state := server.State("web"); state != "STOPPED" {
+		t.Fatalf("web is %s after stop, want STOPPED", state)
+	}
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 0 {
+		t.Fatalf("got %d alerts for a stop from the bot, want none", len(alerts))
+	}
+
+	// The flag only covers that one stop, a later crash is alerted
+	press(h, telegram.Callback{Action: "start", ServerURL: server.URL, Target: "web"})
+	h.CheckProcessStatuses(context.Background())
+	server.SetState("web", "EXITED", 1)
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 1 {
+		t.Errorf("got %d alerts for a crash after the stop, want 1", len(alerts))
+	}
+}
+
+func TestGroupStopMarksOnlyRunningProcesses(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	server.AddProcess(supervisortest.Process{Name: "idle", State: "STOPPED"})
+	h.CheckProcessStatuses(context.Background())
+
+	press(h, telegram.Callback{Action: "stopall", ServerURL: server.URL})
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 0 {
+		t.Fatalf("got %d alerts for stopall, want none", len(alerts))
+	}
+
+	// idle was not running, so stopall did not flag it and its crash is alerted
+	server.SetState("idle", "RUNNING", 0)
+	h.CheckProcessStatuses(context.Background())
+	server.SetState("idle", "EXITED", 1)
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 1 {
+		t.Errorf("got %d alerts for a crash of a process idle at stopall, want 1", len(alerts))
+	}
+}
+
+func TestFailedStopIsNotMarked(t *testing.T) {
+	tests := []struct {
+		action string
+		method string
+		target string
+	}{
+		{action: "stop", method: "supervisor.stopProcess", target: "web"},
+		{action: "stopgroup", method: "supervisor.stopProcessGroup", target: "web"},
+		{action: "stopall", method: "supervisor.stopAllProcesses"},
+	}
+	for _, tt := range tests {
+		h, server, tg := newTestHandler(t)
+		server.FailMethod(tt.method, supervisor.FaultNotRunning, "NOT_RUNNING: web")
+		press(h, telegram.Callback{Action: tt.action, ServerURL: server.URL, Target: tt.target})
+
+		server.SetState("web", "EXITED", 1)
+		h.CheckProcessStatuses(context.Background())
+		if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 1 {
+			t.Errorf("%s: got %d alerts for a crash after a failed stop, want 1", tt.action, len(alerts))
+		}
+	}
+}
+
+func TestStartClearsStopMark(t *testing.T) {
+	tests := []struct {
+		stop, start string
+	}{
+		{stop: "stop", start: "start"},
+		{stop: "stopgroup", start: "startgroup"},
+		{stop: "stopall", start: "startall"},
+	}
+	for _, tt := range tests {
+		h, server, tg := newTestHandler(t)
+
+		// No poll sees the stop, the start must drop its mark
+		press(h, telegram.Callback{Action: tt.stop, ServerURL: server.URL, Target: "web"})
+		press(h, telegram.Callback{Action: tt.start, ServerURL: server.URL, Target: "web"})
+		h.CheckProcessStatuses(context.Background())
+
+		server.SetState("web", "EXITED", 1)
+		h.CheckProcessStatuses(context.Background())
+		if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 1 {
+			t.Errorf("%s then %s: got %d alerts for a later crash, want 1", tt.stop, tt.start, len(alerts))
+		}
+	}
+}
+
+func TestControlCallbacks(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+
+	tests := []struct {
+		action string
+		method []string
+		state  string
+	}{
+		{action: "stop", method: []string{"supervisor.stopProcess"}, state: "STOPPED"},
+		{action: "start", method: []string{"supervisor.startProcess"}, state: "RUNNING"},
+		{action: "restart", method: []string{"supervisor.stopProcess", "supervisor.startProcess"}, state: "RUNNING"},
+	}
+	for _, tt := range tests {
+		before := len(server.Calls())
+		press(h, telegram.Callback{Action: tt.action, ServerURL: server.URL, Target: "web"})
+
+		var control []string
+		for _, call := range server.Calls()[before:] {
+			if call == "supervisor.startProcess" || call == "supervisor.stopProcess" {
+				control = append(control, call)
+			}
+		}
+		if strings.Join(control, ",") != strings.Join(tt.method, ",") {
+			t.Errorf("%s called %v, want %v", tt.action, control, tt.method)
+		}
+		if state := server.State("web"); state != tt.state {
+			t.Errorf("web is %s after %s, want %s", state, tt.action, tt.state)
+		}
+		h.CheckProcessStatuses(context.Background())
+	}
+
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 0 {
+		t.Errorf("got %d alerts for actions from the bot, want none", len(alerts))
+	}
+	entries, err := h.auditLog.Query(audit.Filter{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(entries) != len(tests) {
+		t.Errorf("audit log has %d entries, want %d", len(entries), len(tests))
+	}
+
+	// Faults are reported back and recorded
+	server.FailMethod("supervisor.startProcess", supervisor.FaultSpawnError, "SPAWN_ERROR: web")
+	press(h, telegram.Callback{Action: "restart", ServerURL: server.URL, Target: "web"})
+	if errors := tg.sent(testChatID, "SPAWN\\_ERROR"); len(errors) == 0 {
+		t.Errorf("no error reported for a failed restart")
+	}
+	entries, err = h.auditLog.Query(audit.Filter{Limit: 1})
+	if err != nil || len(entries) != 1 || entries[0].Result == "ok" {
+		t.Errorf("last audit entry = %+v, %v, want the failed restart", entries, err)
+	}
+}
+
+func TestViewerCannotControl(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	viewer := &tgbotapi.User{ID: 2, UserName: "bob"}
+
+	before := len(server.Calls())
+	pressAs(h, viewer, telegram.Callback{Action: "stop", ServerURL: server.URL, Target: "web"})
+	pressAs(h, viewer, telegram.Callback{Action: "startall", ServerURL: server.URL})
+	for _, call := range server.Calls()[before:] {
+		t.Errorf("a viewer's press called %s", call)
+	}
+	if state := server.State("web"); state != "RUNNING" {
+		t.Errorf("web is %s after a viewer pressed stop, want RUNNING", state)
+	}
+	if refusals := tg.sent(testChatID, "⛔ Your role `viewer` can't control processes"); len(refusals) != 2 {
+		t.Errorf("got %d refusals, want 2", len(refusals))
+	}
+
+	// Viewers only get the buttons they can use
+	pressAs(h, viewer, telegram.Callback{Action: "details", ServerURL: server.URL, Target: "web"})
+	pressAs(h, viewer, telegram.Callback{Action: "server", ServerURL: server.URL})
+	cards := tg.sent(testChatID, "")
+	details, controls := cards[len(cards)-2], cards[len(cards)-1]
+	if strings.Contains(details.markup, "Stop") || !strings.Contains(details.markup, "Logs") {
+		t.Errorf("details buttons of a viewer = %s, want Logs without Stop", details.markup)
+	}
+	if strings.Contains(controls.markup, "Start all") || !strings.Contains(controls.markup, "Daemon log") {
+		t.Errorf("server buttons of a viewer = %s, want Daemon log without Start all", controls.markup)
+	}
+}
@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// handleLogCallback shows the page of a process log a 📜 Logs button points
+// at, its arguments being the stream, the offset and "after" for pages that
+// start at the offset rather than end there
+func (h *Handler) handleLogCallback(ctx context.Context, chatID int64, messageID int, user *tgbotapi.User, cb telegram.Callback) {
+	offset, err := strconv.ParseInt(cb.Arg(1), 10, 64)
+	if err != nil {
+		return
+	}
+	if !h.permitted(chatID, user, permissions.ActionView, cb.ServerURL, processGroup(cb.Target)) {
+		return
+	}
+	h.showProcessLog(ctx, chatID, messageID, cb.ServerURL, cb.Target, cb.Arg(0), offset, cb.Arg(2) == "after")
+}
+
+// showProcessLog edits a message into a page of a process log. stream is
+// "out" or "err". The page ends at offset (-1 for the tail), or starts there
+// when after is set.
+func (h *Handler) showProcessLog(ctx context.Context, chatID int64, messageID int, serverURL, processName, stream string, offset int64, after bool) {
+	client := h.supervisorClients[serverURL]
+	tail, read, streamName := client.TailProcessStdoutLog, client.ReadProcessStdoutLog, "stdout"
+	if stream == "err" {
+		tail, read, streamName = client.TailProcessStderrLog, client.ReadProcessStderrLog, "stderr"
+	}
+
+	// A zero-length tail only reports the current log size
+	current, err := tail(ctx, processName, 0, 0)
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("reading log of "+processName, serverURL, err))
+		return
+	}
+	size := current.Offset
+
+	pageBytes := int64(config.LogPageBytes)
+	var start, end int64
+	if after && offset >= 0 && offset < size {
+		start, end = offset, min(offset+pageBytes, size)
+	} else {
+		after = false
+		end = offset
+		if end < 0 || end > size {
+			end = size
+		}
+		start = max(end-pageBytes, 0)
+	}
+
+	data, err := read(ctx, processName, start, end-start)
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("reading log of "+processName, serverURL, err))
+		return
+	}
+	text, shownStart, shownEnd := trimLogWindow(data, start, config.LogTailLines, after, end == size)
+
+	newerStart := int64(-1)
+	if shownEnd < size {
+		newerStart = shownEnd
+	}
+
+	message := telegram.FormatProcessLog(processName, streamName, text, shownStart, shownEnd)
+	keyboard := telegram.BuildProcessLogKeyboard(processName, serverURL, stream, shownStart, newerStart)
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, message, keyboard)
+	editMsg.ParseMode = "MarkdownV2"
+	if _, err := h.bot.Send(editMsg); err != nil {
+		log.Printf("Error updating message with log: %v", err)
+	}
+}
+
+// trimLogWindow picks the lines of one log page out of data read at log
+// offset start. Going back it keeps the last n complete lines of data, going
+// forward (after set) the first n, so paging newer retraces paging older.
+// atEnd tells that data reaches the end of the log, whose last line may still
+// be incomplete. It returns the text and the log offsets it spans.
+func trimLogWindow(data string, start int64, n int, after, atEnd bool) (string, int64, int64) {
+	from, to := 0, len(data)
+	if after {
+		// Pages going forward start at a line, keep whole lines up to n
+		lines := 0
+		lastLine := -1
+		for i := 0; i < len(data); i++ {
+			if data[i] == '\n' {
+				lines++
+				lastLine = i
+				if lines == n {
+					break
+				}
+			}
+		}
+		// A partial last line belongs to the next page, unless nothing follows
+		// it or it is the only line and would otherwise never be shown
+		if lines == n || (!atEnd && lastLine != -1) {
+			to = lastLine + 1
+		}
+	} else {
+		if start > 0 {
+			// The window may begin mid-line, leave the partial line to the older page
+			if i := strings.IndexByte(data, '\n'); i != -1 && i+1 < len(data) {
+				from = i + 1
+			}
+		}
+
+		body := strings.TrimSuffix(data[from:], "\n")
+		lines := 0
+		for i := len(body) - 1; i >= 0; i-- {
+			if body[i] == '\n' {
+				lines++
+				if lines == n {
+					from += i + 1
+					break
+				}
+			}
+		}
+	}
+
+	// Byte windows can split multi-byte characters, which Telegram rejects
+	text := strings.ToValidUTF8(strings.TrimSuffix(data[from:to], "\n"), "")
+	return text, start + int64(from), start + int64(to)
+}
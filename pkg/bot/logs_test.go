@@ -0,0 +1,58 @@
+package bot
+
+import "testing"
+
+func TestTrimLogWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		start    int64
+		n        int
+		after    bool
+		atEnd    bool
+		want     string
+		from, to int64
+	}{
+		{name: "back keeps the last lines", data: "a\nb\nc\nd\n", n: 2, atEnd: true, want: "c\nd", from: 4, to: 8},
+		{name: "back keeps all when short", data: "a\nb\n", n: 5, atEnd: true, want: "a\nb", from: 0, to: 4},
+		{name: "back drops a partial first line", data: "xa\nb\nc\n", start: 10, n: 5, want: "b\nc", from: 13, to: 17},
+		{name: "back keeps a lone partial line", data: "xyz", start: 10, n: 5, atEnd: true, want: "xyz", from: 10, to: 13},
+		{name: "back at the start keeps the first line", data: "a\nb\n", n: 5, want: "a\nb", from: 0, to: 4},
+		{name: "forward keeps the first lines", data: "a\nb\nc\nd\n", n: 2, after: true, want: "a\nb", from: 0, to: 4},
+		{name: "forward leaves a partial line to the next page", data: "a\nb", start: 20, n: 5, after: true, want: "a", from: 20, to: 22},
+		{name: "forward keeps a partial line at the end", data: "a\nb", start: 20, n: 5, after: true, atEnd: true, want: "a\nb", from: 20, to: 23},
+		{name: "forward keeps a line without newline", data: "abc", n: 5, after: true, want: "abc", from: 0, to: 3},
+		{name: "split characters are dropped", data: "\xa9ok\n", n: 5, atEnd: true, want: "ok", from: 0, to: 4},
+		{name: "empty", data: "", n: 5, atEnd: true, want: "", from: 0, to: 0},
+	}
+	for _, tt := range tests {
+		got, from, to := trimLogWindow(tt.data, tt.start, tt.n, tt.after, tt.atEnd)
+		if got != tt.want || from != tt.from || to != tt.to {
+			t.Errorf("%s: trimLogWindow(%q, %d, %d, %v, %v) = %q, %d, %d, want %q, %d, %d",
+				tt.name, tt.data, tt.start, tt.n, tt.after, tt.atEnd, got, from, to, tt.want, tt.from, tt.to)
+		}
+	}
+}
+
+// Paging newer after paging older shows the same pages again
+func TestTrimLogWindowRetraces(t *testing.T) {
+	const log = "one\ntwo\nthree\nfour\nfive\nsix\nseven\n"
+	end := int64(len(log))
+	var pages []string
+	var starts []int64
+	for end > 0 {
+		text, from, _ := trimLogWindow(log[:end], 0, 2, false, end == int64(len(log)))
+		pages = append(pages, text)
+		starts = append(starts, from)
+		end = from
+	}
+
+	// Newer from page i starts where page i-1 does
+	for i := len(pages) - 1; i > 0; i-- {
+		start := starts[i-1]
+		text, _, _ := trimLogWindow(log[start:], start, 2, true, true)
+		if text != pages[i-1] {
+			t.Errorf("newer page from %d = %q, want %q", start, text, pages[i-1])
+		}
+	}
+}
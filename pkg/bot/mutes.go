@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// muted reports whether alerts of a process are silenced, dropping the mute
+// once it has expired
+func (h *Handler) muted(serverURL, processName string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	processKey := serverURL + ":" + processName
+	mute, ok := h.mutes[processKey]
+	if !ok {
+		return false
+	}
+	if !mute.Active(time.Now()) {
+		delete(h.mutes, processKey)
+		h.changed = true
+		return false
+	}
+	return true
+}
+
+// seenRunning lifts a "until fixed" mute once the process runs again.
+// Snoozes run their course, a flapping process passes through RUNNING.
+func (h *Handler) seenRunning(serverURL, processName string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	processKey := serverURL + ":" + processName
+	if mute, ok := h.mutes[processKey]; ok && mute.UntilFixed() {
+		log.Printf("%s runs again on %s, alerts unmuted", processName, serverURL)
+		delete(h.mutes, processKey)
+		h.changed = true
+	}
+}
+
+// activeMutes returns the unexpired mutes of processes the user may view
+func (h *Handler) activeMutes(user *tgbotapi.User) []models.Mute {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	var mutes []models.Mute
+	for processKey, mute := range h.mutes {
+		if !mute.Active(now) {
+			delete(h.mutes, processKey)
+			h.changed = true
+			continue
+		}
+		if roleFor(user, mute.ServerURL, processGroup(mute.Process)).Can(permissions.ActionView) {
+			mutes = append(mutes, mute)
+		}
+	}
+	sort.Slice(mutes, func(i, j int) bool {
+		if mutes[i].ServerURL != mutes[j].ServerURL {
+			return mutes[i].ServerURL < mutes[j].ServerURL
+		}
+		return mutes[i].Process < mutes[j].Process
+	})
+	return mutes
+}
+
+// handleMuteCallback handles the 🔕 snooze and 🔇 mute buttons of an alert,
+// whose argument is a duration or "fixed"
+func (h *Handler) handleMuteCallback(chatID int64, user *tgbotapi.User, cb telegram.Callback) {
+	if !h.permitted(chatID, user, permissions.ActionControl, cb.ServerURL, processGroup(cb.Target)) {
+		return
+	}
+
+	now := time.Now()
+	mute := models.Mute{ServerURL: cb.ServerURL, Process: cb.Target, By: describeUser(user)}
+	if cb.Arg(0) != "fixed" {
+		duration, err := time.ParseDuration(cb.Arg(0))
+		if err != nil {
+			return
+		}
+		mute.Until = now.Add(duration)
+	}
+
+	h.mu.Lock()
+	h.mutes[cb.ServerURL+":"+cb.Target] = mute
+	h.changed = true
+	h.mu.Unlock()
+
+	log.Printf("%s muted alerts for %s on %s until %v", mute.By, mute.Process, mute.ServerURL, mute.Until)
+	h.saveState()
+	h.recordAction(chatID, user, cb.ServerURL, cb.Target, "mute "+cb.Arg(0), nil)
+	telegram.SendToTelegram(h.bot, chatID, telegram.FormatMute(mute, now))
+}
+
+// handleUnmuteCallback lifts a mute and refreshes the /mutes list
+func (h *Handler) handleUnmuteCallback(chatID int64, messageID int, user *tgbotapi.User, cb telegram.Callback) {
+	if !h.permitted(chatID, user, permissions.ActionControl, cb.ServerURL, processGroup(cb.Target)) {
+		return
+	}
+
+	h.mu.Lock()
+	delete(h.mutes, cb.ServerURL+":"+cb.Target)
+	h.changed = true
+	h.mu.Unlock()
+
+	log.Printf("%s unmuted alerts for %s on %s", describeUser(user), cb.Target, cb.ServerURL)
+	h.saveState()
+	h.recordAction(chatID, user, cb.ServerURL, cb.Target, "unmute", nil)
+	telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("🔔 Alerts for `%s` on `%s` resumed",
+		telegram.EscapeMarkdownV2(cb.Target), telegram.EscapeMarkdownV2(cb.ServerURL)))
+	h.ShowMutes(chatID, messageID, user)
+}
+
+// ShowMutes lists the active mutes with buttons to lift them. It edits the
+// message with messageID, or sends a new message when messageID is 0.
+func (h *Handler) ShowMutes(chatID int64, messageID int, user *tgbotapi.User) {
+	mutes := h.activeMutes(user)
+	message := telegram.FormatMutes(mutes, time.Now())
+	keyboard := telegram.BuildMutesKeyboard(mutes)
+	if messageID == 0 {
+		telegram.SendToTelegramWithInlineKeyboard(h.bot, chatID, message, keyboard)
+		return
+	}
+	h.editMessage(chatID, messageID, message, keyboard)
+}
@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// crash takes web from RUNNING to EXITED over two polls and returns the
+// number of crash alerts sent so far
+func crash(h *Handler, server *supervisortest.Server, tg *fakeTelegram) int {
+	server.SetState("web", "RUNNING", 0)
+	h.CheckProcessStatuses(context.Background())
+	server.SetState("web", "EXITED", 1)
+	h.CheckProcessStatuses(context.Background())
+	return len(tg.sent(testChatID, "Process Status Change"))
+}
+
+func TestSnoozeExpires(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+
+	press(h, telegram.Callback{Action: "mute", ServerURL: server.URL, Target: "web", Args: []string{"1h"}})
+	if got := crash(h, server, tg); got != 0 {
+		t.Fatalf("got %d alerts while snoozed, want none", got)
+	}
+	// Running again doesn't end a snooze, a flapping process passes through RUNNING
+	if got := crash(h, server, tg); got != 0 {
+		t.Fatalf("got %d alerts after running again while snoozed, want none", got)
+	}
+
+	h.mu.Lock()
+	mute := h.mutes[server.URL+":web"]
+	mute.Until = time.Now().Add(-time.Second)
+	h.mutes[server.URL+":web"] = mute
+	h.mu.Unlock()
+
+	if got := crash(h, server, tg); got != 1 {
+		t.Errorf("got %d alerts after the snooze expired, want 1", got)
+	}
+	if mutes := h.activeMutes(&tgbotapi.User{ID: 1}); len(mutes) != 0 {
+		t.Errorf("active mutes = %+v after expiry, want none", mutes)
+	}
+}
+
+func TestMuteUntilFixed(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+
+	press(h, telegram.Callback{Action: "mute", ServerURL: server.URL, Target: "web", Args: []string{"fixed"}})
+	server.SetState("web", "EXITED", 1)
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 0 {
+		t.Fatalf("got %d alerts while muted, want none", len(alerts))
+	}
+	// Not running yet, the mute holds however long it takes
+	h.CheckProcessStatuses(context.Background())
+	if mutes := h.activeMutes(&tgbotapi.User{ID: 1}); len(mutes) != 1 {
+		t.Fatalf("active mutes = %+v while still down, want web", mutes)
+	}
+
+	// Seen RUNNING, the mute is lifted and the next crash is alerted
+	if got := crash(h, server, tg); got != 1 {
+		t.Errorf("got %d alerts for a crash after recovering, want 1", got)
+	}
+	if mutes := h.activeMutes(&tgbotapi.User{ID: 1}); len(mutes) != 0 {
+		t.Errorf("active mutes = %+v after recovering, want none", mutes)
+	}
+}
+
+func TestMuteNeedsControl(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+
+	pressAs(h, &tgbotapi.User{ID: 4}, telegram.Callback{Action: "mute", ServerURL: server.URL, Target: "web", Args: []string{"8h"}})
+	press(h, telegram.Callback{Action: "mute", ServerURL: server.URL, Target: "web", Args: []string{"soon"}})
+	if mutes := h.activeMutes(&tgbotapi.User{ID: 1}); len(mutes) != 0 {
+		t.Errorf("active mutes = %+v from a viewer and a bad duration, want none", mutes)
+	}
+	if refusals := tg.sent(testChatID, "⛔ Your role `viewer` can't"); len(refusals) != 1 {
+		t.Errorf("got %d refusals for a viewer, want 1", len(refusals))
+	}
+}
@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// showProcessConfig edits a message into the configuration of a process and
+// its current state, both fetched in one round trip
+func (h *Handler) showProcessConfig(ctx context.Context, chatID int64, messageID int, serverURL, processName string) {
+	snapshot, err := h.supervisorClients[serverURL].GetSnapshot(ctx, true)
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("getting config of "+processName, serverURL, err))
+		return
+	}
+
+	state := ""
+	for _, process := range snapshot.Processes {
+		if process.FullName() == processName {
+			state = process.State
+		}
+	}
+
+	configs := snapshot.Configs
+	for _, config := range configs {
+		if config.FullName() != processName {
+			continue
+		}
+		groupSize := 0
+		for _, other := range configs {
+			if other.Group == config.Group {
+				groupSize++
+			}
+		}
+		message := telegram.FormatProcessConfig(config, serverURL, state, groupSize)
+		h.editMessage(chatID, messageID, message, telegram.BuildProcessConfigKeyboard(processName, serverURL))
+		return
+	}
+
+	telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("No config found for `%s`", telegram.EscapeMarkdownV2(processName)))
+}
@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+func TestProcessConfigCard(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	server.AddProcess(supervisortest.Process{Name: "worker_0", Group: "worker", State: "RUNNING", Command: "/usr/bin/worker -n 0"})
+	server.AddProcess(supervisortest.Process{Name: "worker_1", Group: "worker", State: "STARTING"})
+
+	press(h, telegram.Callback{Action: "config", ServerURL: server.URL, Target: "worker:worker_0"})
+	cards := tg.sent(testChatID, "*Process Config*")
+	if len(cards) != 1 {
+		t.Fatalf("got %d config cards, want 1", len(cards))
+	}
+	for _, want := range []string{"`worker:worker\\_0`", "\\(2 processes\\)", "*State:* `RUNNING`", "*Command:* `/usr/bin/worker -n 0`", "*Autorestart:* `unexpected`"} {
+		if !strings.Contains(cards[0].text, want) {
+			t.Errorf("card = %q, want %s", cards[0].text, want)
+		}
+	}
+	if !strings.Contains(cards[0].markup, "Details") {
+		t.Errorf("card buttons = %s, want a way back to the details", cards[0].markup)
+	}
+
+	press(h, telegram.Callback{Action: "config", ServerURL: server.URL, Target: "web"})
+	if cards := tg.sent(testChatID, "*Process Config*"); len(cards) != 2 || !strings.Contains(cards[1].text, "\\(1 process\\)") {
+		t.Errorf("web card = %+v, want a group of 1 process", cards[1:])
+	}
+
+	press(h, telegram.Callback{Action: "config", ServerURL: server.URL, Target: "missing"})
+	if missing := tg.sent(testChatID, "No config found for `missing`"); len(missing) != 1 {
+		t.Errorf("got %d replies for a missing process, want 1", len(missing))
+	}
+}
+
+func TestProcessConfigFaults(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+
+	server.FailMethod("supervisor.getAllConfigInfo", supervisor.FaultFailed, "FAILED")
+	press(h, telegram.Callback{Action: "config", ServerURL: server.URL, Target: "web"})
+	if replies := tg.sent(testChatID, "while getting config of web"); len(replies) != 1 {
+		t.Errorf("got %d errors for a failed config call, want 1", len(replies))
+	}
+	server.ClearFault("supervisor.getAllConfigInfo")
+
+	// Users who can't view the group get no card
+	config.Permissions = &permissions.Policy{DefaultRole: permissions.RoleNone}
+	pressAs(h, &tgbotapi.User{ID: 5}, telegram.Callback{Action: "config", ServerURL: server.URL, Target: "web"})
+	if cards := tg.sent(testChatID, "*Process Config*"); len(cards) != 0 {
+		t.Errorf("got %d config cards for a user without access, want none", len(cards))
+	}
+	if refusals := tg.sent(testChatID, "⛔ Your role `none` can't"); len(refusals) != 1 {
+		t.Errorf("got %d refusals, want 1", len(refusals))
+	}
+}
@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// ShowConfigChanges rereads the configuration on every server the user
+// administers and lists the changed groups with buttons to apply them
+func (h *Handler) ShowConfigChanges(ctx context.Context, chatID int64, user *tgbotapi.User) {
+	serverURLs := make([]string, 0, len(h.supervisorClients))
+	for serverURL := range h.supervisorClients {
+		if roleFor(user, serverURL, "").Can(permissions.ActionAdmin) {
+			serverURLs = append(serverURLs, serverURL)
+		}
+	}
+	if len(serverURLs) == 0 {
+		telegram.SendToTelegram(h.bot, chatID, "⛔ Only admins can reload the configuration\\.")
+		return
+	}
+	sort.Strings(serverURLs)
+
+	var message strings.Builder
+	message.WriteString("*Configuration Changes*\n\n")
+	var pending []string
+	for _, serverURL := range serverURLs {
+		changes, err := h.supervisorClients[serverURL].ReloadConfig(ctx)
+		if err != nil {
+			message.WriteString(telegram.FormatClientError("rereading config", serverURL, err) + "\n\n")
+			continue
+		}
+		message.WriteString(telegram.FormatConfigChanges(serverURL, changes) + "\n")
+		if !changes.Empty() {
+			pending = append(pending, serverURL)
+		}
+	}
+
+	if len(pending) == 0 {
+		telegram.SendToTelegram(h.bot, chatID, message.String())
+		return
+	}
+	telegram.SendToTelegramWithInlineKeyboard(h.bot, chatID, message.String(), telegram.BuildConfigReloadKeyboard(pending))
+}
+
+// handleReloadCallback applies the configuration on one server, or on every
+// server the user administers when serverURL is empty
+func (h *Handler) handleReloadCallback(ctx context.Context, chatID int64, user *tgbotapi.User, serverURL string) {
+	if serverURL != "" {
+		if !h.permitted(chatID, user, permissions.ActionAdmin, serverURL, "") {
+			return
+		}
+		err := h.applyConfigChanges(ctx, chatID, serverURL)
+		h.recordAction(chatID, user, serverURL, "", "reload", err)
+		return
+	}
+
+	// Like /reload, the other servers are left out without a word
+	var serverURLs []string
+	for serverURL := range h.supervisorClients {
+		if roleFor(user, serverURL, "").Can(permissions.ActionAdmin) {
+			serverURLs = append(serverURLs, serverURL)
+		}
+	}
+	if len(serverURLs) == 0 {
+		telegram.SendToTelegram(h.bot, chatID, "⛔ Only admins can reload the configuration\\.")
+		return
+	}
+	sort.Strings(serverURLs)
+	for _, serverURL := range serverURLs {
+		err := h.applyConfigChanges(ctx, chatID, serverURL)
+		h.recordAction(chatID, user, serverURL, "", "reload", err)
+	}
+}
+
+// applyConfigChanges rereads the config again, so whatever is on disk now is
+// applied, and updates the server like `supervisorctl update`. Errors are
+// reported to the chat and returned for the audit log.
+func (h *Handler) applyConfigChanges(ctx context.Context, chatID int64, serverURL string) error {
+	client := h.supervisorClients[serverURL]
+	changes, err := client.ReloadConfig(ctx)
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("rereading config", serverURL, err))
+		return err
+	}
+	if changes.Empty() {
+		telegram.SendToTelegram(h.bot, chatID, "*Configuration unchanged*\n\n"+telegram.FormatConfigChanges(serverURL, changes))
+		return nil
+	}
+
+	// Groups being replaced or removed are stopped on purpose. Like a
+	// restart, the flags are dropped afterwards in case no tick saw the stop.
+	stopped := append(append([]string{}, changes.Changed...), changes.Removed...)
+	for _, group := range stopped {
+		h.markGroupUserStopped(ctx, serverURL, group)
+	}
+
+	log.Printf("Applying config on %s: %+v", serverURL, changes)
+	err = client.UpdateConfig(ctx, changes)
+	for _, group := range stopped {
+		h.clearGroupUserStopped(serverURL, group)
+	}
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("applying config", serverURL, err))
+		return err
+	}
+	telegram.SendToTelegram(h.bot, chatID, "*Configuration applied*\n\n"+telegram.FormatConfigChanges(serverURL, changes))
+	return nil
+}
@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+func TestReloadOnlyAdministeredServers(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	other := addTestServer(t, h)
+	for _, s := range []*supervisortest.Server{server, other} {
+		s.SetConfig(supervisortest.Process{Name: "web", Command: "/usr/bin/web --port=8080"}, supervisortest.Process{Name: "cron"})
+	}
+	config.Permissions = &permissions.Policy{
+		DefaultRole: permissions.RoleViewer,
+		Users:       map[int64][]permissions.Grant{1: {{Role: permissions.RoleOperator}, {Role: permissions.RoleAdmin, Server: server.URL}}},
+	}
+	admin := &tgbotapi.User{ID: 1}
+
+	sendCommand(h, admin, "/reload")
+	if changes := tg.sent(testChatID, "➕ added `cron`"); len(changes) != 1 {
+		t.Errorf("got %d change lists with cron, want 1 for the administered server", len(changes))
+	}
+
+	otherCalls := len(other.Calls())
+	pressAs(h, admin, telegram.Callback{Action: "reload"})
+	if state := server.State("cron"); state != "RUNNING" {
+		t.Errorf("cron is %q on the administered server, want RUNNING", state)
+	}
+	if state := server.State("web"); state != "RUNNING" {
+		t.Errorf("changed web is %q after the update, want RUNNING", state)
+	}
+	if len(other.Calls()) != otherCalls || other.State("cron") != "" {
+		t.Error("applied the config on a server the user doesn't administer")
+	}
+	if refusals := tg.sent(testChatID, "⛔"); len(refusals) != 0 {
+		t.Errorf("fleet-wide apply refused %d servers out loud, want none", len(refusals))
+	}
+	if applied := tg.sent(testChatID, "*Configuration applied*"); len(applied) != 1 {
+		t.Errorf("got %d applied reports, want 1", len(applied))
+	}
+
+	// Restarting the changed group was on purpose
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 0 {
+		t.Errorf("got %d alerts for applying the config, want none", len(alerts))
+	}
+
+	// Users who administer nothing are told so once
+	otherCalls = len(other.Calls())
+	pressAs(h, &tgbotapi.User{ID: 2}, telegram.Callback{Action: "reload"})
+	if refusals := tg.sent(testChatID, "Only admins can reload the configuration"); len(refusals) != 1 {
+		t.Errorf("got %d refusals for a viewer, want 1", len(refusals))
+	}
+	if len(other.Calls()) != otherCalls {
+		t.Error("a viewer's reload reached a server")
+	}
+}
+
+func TestReloadOneServerNeedsAdmin(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	server.SetConfig(supervisortest.Process{Name: "web"}, supervisortest.Process{Name: "cron"})
+
+	before := len(server.Calls())
+	press(h, telegram.Callback{Action: "reload", ServerURL: server.URL})
+	if refusals := tg.sent(testChatID, "⛔ Your role `operator` can't administer servers"); len(refusals) != 1 {
+		t.Errorf("got %d refusals, want 1", len(refusals))
+	}
+	if len(server.Calls()) != before {
+		t.Error("an operator's reload reached the server")
+	}
+}
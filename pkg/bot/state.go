@@ -0,0 +1,218 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/state"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// stateHeartbeat is how often an unchanged state is saved anyway, so the
+// downtime report knows roughly when the bot stopped
+const stateHeartbeat = time.Minute
+
+// currentState collects the monitor state of the configured servers
+func (h *Handler) currentState() state.State {
+	current := state.State{Servers: make(map[string]state.ServerState, len(h.supervisorClients))}
+	now := time.Now()
+	h.mu.Lock()
+	for serverURL := range h.supervisorClients {
+		prefix := serverURL + ":"
+		server := state.ServerState{Processes: make(map[string]string)}
+		for processKey, status := range h.previousStatus {
+			if process, ok := strings.CutPrefix(processKey, prefix); ok {
+				server.Processes[process] = status
+			}
+		}
+		for processKey := range h.userStoppedProcesses {
+			if process, ok := strings.CutPrefix(processKey, prefix); ok {
+				server.UserStopped = append(server.UserStopped, process)
+			}
+		}
+		sort.Strings(server.UserStopped)
+		current.Servers[serverURL] = server
+	}
+	for _, mute := range h.mutes {
+		if mute.Active(now) {
+			current.Mutes = append(current.Mutes, mute)
+		}
+	}
+	h.mu.Unlock()
+	sort.Slice(current.Mutes, func(i, j int) bool {
+		if current.Mutes[i].ServerURL != current.Mutes[j].ServerURL {
+			return current.Mutes[i].ServerURL < current.Mutes[j].ServerURL
+		}
+		return current.Mutes[i].Process < current.Mutes[j].Process
+	})
+
+	current.Subscriptions = h.subscriptions.snapshot()
+	for _, registered := range telegram.RegisteredCallbacks() {
+		if !keepButton(registered.Callback) {
+			continue
+		}
+		current.Buttons = append(current.Buttons, state.Button{
+			Token:     registered.Token,
+			Action:    registered.Callback.Action,
+			ServerURL: registered.Callback.ServerURL,
+			Target:    registered.Callback.Target,
+			Args:      registered.Callback.Args,
+			Expires:   registered.Expires,
+		})
+	}
+	return current
+}
+
+// keepButton reports whether a button is worth saving across restarts. Alerts,
+// details cards, server controls and lists stay on screen and keep theirs.
+// Pages of logs, searches and audit entries are paged through and left, and
+// confirmations are not kept anyway, a fresh command brings those back.
+func keepButton(cb telegram.Callback) bool {
+	switch cb.Action {
+	case "find", "audit", "confirm", "cancel", "dlogclear", "dlogclearok":
+		return false
+	case "log":
+		// The 📜 Logs button of a card opens the tail
+		return cb.Arg(1) == "-1"
+	case "dlog":
+		// The 📜 Daemon log button of the server controls opens the latest page
+		return cb.Arg(0) == "0" && cb.Arg(1) == ""
+	}
+	return true
+}
+
+// stateChanged marks the state as changed for changes made outside h.mu,
+// such as subscriptions
+func (h *Handler) stateChanged() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.changed = true
+}
+
+// saveState persists the monitor state when it changed, or at least every
+// stateHeartbeat. Besides the monitor loop, mute and subscription changes
+// call it from the updates goroutine.
+func (h *Handler) saveState() {
+	h.saveMu.Lock()
+	defer h.saveMu.Unlock()
+
+	now := time.Now()
+	callbacks := telegram.CallbacksVersion()
+	h.mu.Lock()
+	changed := h.changed || callbacks != h.savedCallbacks
+	// Changes made while saving are saved the next time
+	h.changed = false
+	h.mu.Unlock()
+	if !changed && now.Sub(h.savedAt) < stateHeartbeat {
+		return
+	}
+
+	current := h.currentState()
+	current.SavedAt = now
+	if err := h.store.Save(current); err != nil {
+		log.Printf("Error saving state: %v", err)
+		h.stateChanged()
+		return
+	}
+	h.savedAt, h.savedCallbacks = now, callbacks
+}
+
+// RestoreState loads the state saved by the last run and reports to the main
+// chat what changed on the servers while the bot was down. Polling then
+// continues from the live state, so those changes are not alerted again.
+func (h *Handler) RestoreState(ctx context.Context) {
+	saved, err := h.store.Load()
+	if err != nil {
+		log.Printf("Error loading state, starting fresh: %v", err)
+		return
+	}
+
+	now := time.Now()
+	if saved.SavedAt.IsZero() && config.SubscriptionsFile != "" {
+		// First run with a state file, take over what older versions kept
+		// in SUBSCRIPTIONS_FILE
+		users, err := loadLegacySubscriptions(config.SubscriptionsFile)
+		if err != nil {
+			log.Printf("Error importing subscriptions: %v", err)
+		} else if len(users) > 0 {
+			log.Printf("Imported %d subscriptions from %s, the file is no longer used", len(users), config.SubscriptionsFile)
+			saved.Subscriptions = users
+			defer h.saveState()
+		}
+	}
+	h.subscriptions.restore(saved.Subscriptions)
+	buttons := make([]telegram.RegisteredCallback, 0, len(saved.Buttons))
+	for _, button := range saved.Buttons {
+		buttons = append(buttons, telegram.RegisteredCallback{
+			Token:    button.Token,
+			Callback: telegram.Callback{Action: button.Action, ServerURL: button.ServerURL, Target: button.Target, Args: button.Args},
+			Expires:  button.Expires,
+		})
+	}
+	telegram.RestoreCallbacks(buttons)
+	h.mu.Lock()
+	for _, mute := range saved.Mutes {
+		if mute.Active(now) {
+			h.mutes[mute.ServerURL+":"+mute.Process] = mute
+		}
+	}
+	h.mu.Unlock()
+	if saved.SavedAt.IsZero() {
+		return
+	}
+
+	changes := make(map[string][]state.Change)
+	var unreachable []string
+	for _, result := range h.fetchAllProcesses(ctx) {
+		serverURL := result.serverURL
+		server, known := saved.Servers[serverURL]
+		if result.err != nil {
+			// Keep the saved view, polling alerts on changes once the server answers
+			log.Printf("Error getting processes from %s: %v", serverURL, result.err)
+			for process, status := range server.Processes {
+				h.recordStatus(serverURL+":"+process, status)
+			}
+			for _, process := range server.UserStopped {
+				h.markUserStopped(serverURL + ":" + process)
+			}
+			if known {
+				unreachable = append(unreachable, serverURL)
+			}
+			continue
+		}
+
+		live := make(map[string]string, len(result.processes))
+		for _, process := range result.processes {
+			live[process.FullName()] = process.State
+			h.recordStatus(serverURL+":"+process.FullName(), process.State)
+		}
+		if !known {
+			continue
+		}
+		for _, process := range server.UserStopped {
+			// The flag only holds while the process stays where the user left it
+			if status, ok := live[process]; ok && status == server.Processes[process] {
+				h.markUserStopped(serverURL + ":" + process)
+			}
+		}
+		for _, change := range state.Diff(server.Processes, live) {
+			if !h.muted(serverURL, change.Process) {
+				changes[serverURL] = append(changes[serverURL], change)
+			}
+		}
+	}
+
+	if len(changes) == 0 && len(unreachable) == 0 {
+		log.Printf("Nothing changed since the state saved at %v", saved.SavedAt)
+		return
+	}
+	sort.Strings(unreachable)
+	message := telegram.FormatDowntimeReport(saved.SavedAt, now, changes, unreachable)
+	if err := telegram.SendToTelegram(h.bot, config.TelegramChatID, message); err != nil {
+		log.Printf("Error sending downtime report to Telegram: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/state"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// memoryStore is a state.Store that keeps the last saved state
+type memoryStore struct {
+	mu    sync.Mutex
+	state state.State
+	saves int
+}
+
+func (s *memoryStore) Load() (state.State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, nil
+}
+
+func (s *memoryStore) Save(saved state.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = saved
+	s.saves++
+	return nil
+}
+
+func (s *memoryStore) saveCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+func TestStateIsSavedOnlyOnChange(t *testing.T) {
+	store := &memoryStore{}
+	h, server, _ := newStoredTestHandler(t, store)
+
+	h.CheckProcessStatuses(context.Background())
+	h.CheckProcessStatuses(context.Background())
+	if saves := store.saveCount(); saves != 1 {
+		t.Fatalf("got %d saves after two polls without changes, want 1", saves)
+	}
+
+	server.SetState("web", "STOPPED", 0)
+	h.CheckProcessStatuses(context.Background())
+	if saves := store.saveCount(); saves != 2 {
+		t.Errorf("got %d saves after a state change, want 2", saves)
+	}
+
+	press(h, telegram.Callback{Action: "mute", ServerURL: server.URL, Target: "web", Args: []string{"1h"}})
+	saves := store.saveCount()
+	if saves != 3 {
+		t.Errorf("got %d saves after a mute, want 3", saves)
+	}
+	h.CheckProcessStatuses(context.Background())
+	if got := store.saveCount(); got != saves {
+		t.Errorf("got %d saves after a poll without changes, want %d", got, saves)
+	}
+}
+
+func TestRestoreStateReportsDowntime(t *testing.T) {
+	store := &memoryStore{}
+	h, server, tg := newStoredTestHandler(t, store)
+	store.state = state.State{
+		SavedAt: time.Now().Add(-time.Hour),
+		Servers: map[string]state.ServerState{server.URL: {Processes: map[string]string{"web": "RUNNING", "gone": "RUNNING"}}},
+	}
+	server.SetState("web", "FATAL", 1)
+
+	h.RestoreState(context.Background())
+	reports := tg.sent(testChatID, "Changes While the Bot Was Down")
+	if len(reports) != 1 {
+		t.Fatalf("got %d downtime reports, want 1", len(reports))
+	}
+	for _, want := range []string{"`web` `RUNNING` → `FATAL`", "`gone` removed"} {
+		if !strings.Contains(reports[0].text, want) {
+			t.Errorf("report %q lacks %q", reports[0].text, want)
+		}
+	}
+
+	// Polling goes on from the live state, the change is not alerted again
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(testChatID, "Process Status Change"); len(alerts) != 0 {
+		t.Errorf("got %d alerts after the report, want none", len(alerts))
+	}
+}
+
+func TestMuteAndSubscriptionChangesAreSaved(t *testing.T) {
+	store := &memoryStore{}
+	h, server, _ := newStoredTestHandler(t, store)
+	h.RestoreState(context.Background())
+
+	press(h, telegram.Callback{Action: "mute", ServerURL: server.URL, Target: "web", Args: []string{"1h"}})
+	if saved, _ := store.Load(); len(saved.Mutes) != 1 || saved.Mutes[0].Process != "web" {
+		t.Errorf("saved mutes = %+v, want web", saved.Mutes)
+	}
+
+	press(h, telegram.Callback{Action: "sub", ServerURL: server.URL, Args: []string{"0"}})
+	if saved, _ := store.Load(); len(saved.Subscriptions) != 1 || saved.Subscriptions[0].ChatID != 1 {
+		t.Errorf("saved subscriptions = %+v, want user 1", saved.Subscriptions)
+	}
+
+	press(h, telegram.Callback{Action: "unmute", ServerURL: server.URL, Target: "web"})
+	if saved, _ := store.Load(); len(saved.Mutes) != 0 {
+		t.Errorf("saved mutes = %+v after unmute, want none", saved.Mutes)
+	}
+}
+
+func TestImportLegacySubscriptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	if err := os.WriteFile(path, []byte(`[{"chat_id":7,"choosen_processes":["http://web1:9001/RPC2"]}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file := config.SubscriptionsFile
+	config.SubscriptionsFile = path
+	defer func() { config.SubscriptionsFile = file }()
+
+	store := &memoryStore{}
+	h, _, _ := newStoredTestHandler(t, store)
+	h.RestoreState(context.Background())
+	if saved, _ := store.Load(); len(saved.Subscriptions) != 1 || saved.Subscriptions[0].ChatID != 7 {
+		t.Fatalf("saved subscriptions = %+v, want the imported ones", saved.Subscriptions)
+	}
+	if !h.subscriptions.chose(7, "http://web1:9001/RPC2") {
+		t.Error("imported subscription is not active")
+	}
+
+	// Once the state was saved the old file is left alone
+	store.state.Subscriptions = nil
+	h, _, _ = newStoredTestHandler(t, store)
+	h.RestoreState(context.Background())
+	if h.subscriptions.chose(7, "http://web1:9001/RPC2") {
+		t.Error("subscriptions imported again over a saved state")
+	}
+}
+
+func TestButtonsSurviveRestart(t *testing.T) {
+	store := &memoryStore{}
+	h, server, tg := newStoredTestHandler(t, store)
+	h.RestoreState(context.Background())
+
+	token := telegram.EncodeCallback(telegram.DetailsCallback("web", server.URL))
+	h.CheckProcessStatuses(context.Background())
+	saved, _ := store.Load()
+	found := false
+	for _, button := range saved.Buttons {
+		found = found || button.Token == token && button.Action == "details" && button.Target == "web"
+	}
+	if !found {
+		t.Fatalf("saved buttons = %+v, want the details button %s", saved.Buttons, token)
+	}
+
+	// A token only the last run knew works after restoring its state
+	restored := "restoredToken000"
+	store.state.Buttons = append(store.state.Buttons, state.Button{
+		Token: restored, Action: "details", ServerURL: server.URL, Target: "web", Expires: time.Now().Add(time.Hour),
+	})
+	h = NewHandler(h.bot, h.supervisorClients, store)
+	h.RestoreState(context.Background())
+	h.handleCallbackQuery(&tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &tgbotapi.User{ID: 1},
+		Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: testChatID}},
+		Data:    restored,
+	})
+	if cards := tg.sent(testChatID, "*Process Details*"); len(cards) != 1 {
+		t.Errorf("got %d details cards for a restored button, want 1", len(cards))
+	}
+}
+
+func TestThrowawayButtonsAreNotSaved(t *testing.T) {
+	store := &memoryStore{}
+	h, server, _ := newStoredTestHandler(t, store)
+
+	kept := []telegram.Callback{
+		telegram.DetailsCallback("web", server.URL),
+		{Action: "mute", ServerURL: server.URL, Target: "web", Args: []string{"8h"}},
+		telegram.ProcessLogCallback("web", server.URL, "out", -1, false),
+		telegram.DaemonLogCallback(server.URL, 0, false),
+	}
+	dropped := []telegram.Callback{
+		telegram.FindCallback("web", 2),
+		telegram.AuditCallback("user=@alice", 40, false),
+		telegram.ProcessLogCallback("web", server.URL, "out", 4096, false),
+		telegram.ProcessLogCallback("web", server.URL, "err", 1024, true),
+		telegram.DaemonLogCallback(server.URL, 2000, false),
+		{Action: "confirm", Target: "0123456789ab"},
+	}
+	for _, cb := range append(kept, dropped...) {
+		telegram.EncodeCallback(cb)
+	}
+	h.saveState()
+	saved := make(map[string]bool)
+	for _, button := range store.state.Buttons {
+		saved[button.Token] = true
+	}
+
+	for _, cb := range kept {
+		if !saved[telegram.EncodeCallback(cb)] {
+			t.Errorf("%s button %v was not saved", cb.Action, cb.Args)
+		}
+	}
+	for _, cb := range dropped {
+		if saved[telegram.EncodeCallback(cb)] {
+			t.Errorf("%s button %v was saved", cb.Action, cb.Args)
+		}
+	}
+}
+
+// Button presses run on the updates goroutine while the monitor loop polls,
+// run with -race to check the shared maps
+func TestConcurrentPollsAndPresses(t *testing.T) {
+	h, server, _ := newStoredTestHandler(t, &memoryStore{})
+	h.CheckProcessStatuses(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			action := "stop"
+			if i%2 == 1 {
+				action = "start"
+			}
+			press(h, telegram.Callback{Action: action, ServerURL: server.URL, Target: "web"})
+			press(h, telegram.Callback{Action: "mute", ServerURL: server.URL, Target: "web", Args: []string{"fixed"}})
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			h.CheckProcessStatuses(context.Background())
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/utils"
+)
+
+// SendStdin handles "/stdin <process>[@<server>] <text>". The text is sent
+// with a trailing newline since line-reading workers expect one.
+func (h *Handler) SendStdin(ctx context.Context, chatID int64, user *tgbotapi.User, target, text string) {
+	process, ok := h.resolveProcess(ctx, chatID, user, target)
+	if !ok {
+		return
+	}
+	if !h.permitted(chatID, user, permissions.ActionAdmin, process.ServerURL, process.Group) {
+		return
+	}
+	log.Printf("User %d sends %q to stdin of %s on %s", user.ID, text, process.FullName(), process.ServerURL)
+	err := h.supervisorClients[process.ServerURL].SendProcessStdin(ctx, process.FullName(), text+"\n")
+	h.recordAction(chatID, user, process.ServerURL, process.FullName(), "stdin", err)
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("writing stdin of "+process.FullName(), process.ServerURL, err))
+		return
+	}
+	telegram.SendStatusMessage(h.bot, chatID, process.FullName(), "received input")
+}
+
+// findProcesses returns the processes matching name on every server, or only
+// on the server given by URL or short ID when server is set
+func (h *Handler) findProcesses(ctx context.Context, name, server string) []models.Process {
+	var found []models.Process
+	for serverURL, client := range h.supervisorClients {
+		if server != "" && server != serverURL && server != utils.GetShortServerId(serverURL) {
+			continue
+		}
+		processes, err := client.GetAllProcesses(ctx)
+		if err != nil {
+			log.Printf("Error getting processes from %s: %v", serverURL, err)
+			continue
+		}
+		for _, process := range processes {
+			if process.Matches(name) {
+				process.ServerURL = serverURL
+				found = append(found, process)
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ServerURL < found[j].ServerURL })
+	return found
+}
@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/audit"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+)
+
+// stdinAdmin may write to stdin, user 1 is only an operator
+var stdinAdmin = &tgbotapi.User{ID: 3, UserName: "carol"}
+
+func withStdinAdmin() {
+	config.Permissions = &permissions.Policy{
+		DefaultRole: permissions.RoleViewer,
+		Admins:      []int64{stdinAdmin.ID},
+		Users:       map[int64][]permissions.Grant{1: {{Role: permissions.RoleOperator}}},
+	}
+}
+
+func TestStdin(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	withStdinAdmin()
+
+	sendCommand(h, stdinAdmin, "/stdin web reload cache now")
+	if got := server.Stdin("web"); got != "reload cache now\n" {
+		t.Errorf("stdin of web = %q, want the text and a newline", got)
+	}
+	if replies := tg.sent(testChatID, "received input"); len(replies) != 1 {
+		t.Errorf("got %d confirmations, want 1", len(replies))
+	}
+
+	entries, err := h.auditLog.Query(audit.Filter{User: "@carol"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != "stdin" || entries[0].Target != "web" || entries[0].Result != "ok" {
+		t.Errorf("audit entries = %+v, want one successful stdin on web", entries)
+	}
+}
+
+func TestStdinNeedsAdmin(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	withStdinAdmin()
+
+	sendCommand(h, &tgbotapi.User{ID: 1, UserName: "alice"}, "/stdin web hello")
+	if server.Stdin("web") != "" {
+		t.Errorf("an operator wrote %q to stdin", server.Stdin("web"))
+	}
+	if refusals := tg.sent(testChatID, "⛔ Your role `operator` can't"); len(refusals) != 1 {
+		t.Errorf("got %d refusals, want 1", len(refusals))
+	}
+	if entries, _ := h.auditLog.Query(audit.Filter{}); len(entries) != 0 {
+		t.Errorf("audit entries = %+v for a refused write, want none", entries)
+	}
+}
+
+func TestStdinNotRunning(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	withStdinAdmin()
+	server.SetState("web", "STOPPED", 0)
+
+	sendCommand(h, stdinAdmin, "/stdin web hello")
+	faults := tg.sent(testChatID, "NOT\\_RUNNING")
+	if len(faults) != 1 || !strings.Contains(faults[0].text, "writing stdin of web") {
+		t.Errorf("replies = %+v, want one NOT_RUNNING reply about writing stdin", faults)
+	}
+	if replies := tg.sent(testChatID, "received input"); len(replies) != 0 {
+		t.Errorf("got %d confirmations of a failed write", len(replies))
+	}
+
+	entries, _ := h.auditLog.Query(audit.Filter{})
+	if len(entries) != 1 || !strings.Contains(entries[0].Result, "NOT_RUNNING") {
+		t.Errorf("audit entries = %+v, want the failure recorded", entries)
+	}
+}
@@ -0,0 +1,258 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+// subscriptionStore keeps every user's subscriptions. Users are keyed by
+// their private chat ID, which Telegram makes equal to the user ID. The
+// monitor state persists them across restarts.
+type subscriptionStore struct {
+	mu    sync.Mutex
+	users map[int64]*models.User
+}
+
+func newSubscriptionStore() *subscriptionStore {
+	return &subscriptionStore{users: make(map[int64]*models.User)}
+}
+
+// restore replaces the subscriptions with saved ones
+func (s *subscriptionStore) restore(users []models.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = make(map[int64]*models.User, len(users))
+	for _, user := range users {
+		s.users[user.ChatID] = &user
+	}
+}
+
+// loadLegacySubscriptions reads the subscriptions file of older versions, a
+// JSON list of users. A missing file means there is nothing to import.
+func loadLegacySubscriptions(path string) ([]models.User, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subscriptions file: %w", err)
+	}
+	var users []models.User
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse subscriptions file %s: %w", path, err)
+	}
+	return users, nil
+}
+
+// snapshot returns a copy of the subscriptions ordered by chat ID
+func (s *subscriptionStore) snapshot() []models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, models.User{
+			ChatID:           user.ChatID,
+			ChoosenProcesses: append([]string(nil), user.ChoosenProcesses...),
+		})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ChatID < users[j].ChatID })
+	return users
+}
+
+// chose reports whether the user subscribed to key
+func (s *subscriptionStore) chose(chatID int64, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[chatID]
+	return ok && user.Chose(key)
+}
+
+// toggle subscribes the user to key or unsubscribes them
+func (s *subscriptionStore) toggle(chatID int64, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[chatID]
+	if !ok {
+		user = &models.User{ChatID: chatID}
+		s.users[chatID] = user
+	}
+	user.Toggle(key)
+	if len(user.ChoosenProcesses) == 0 {
+		delete(s.users, chatID)
+	}
+}
+
+// subscribers returns the chats subscribed to a process, its group or server
+func (s *subscriptionStore) subscribers(serverURL string, process models.Process) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var chatIDs []int64
+	for chatID, user := range s.users {
+		if user.SubscribedTo(serverURL, process) {
+			chatIDs = append(chatIDs, chatID)
+		}
+	}
+	return chatIDs
+}
+
+// ShowSubscriptions lists the servers the user can subscribe to. It edits
+// the message with messageID, or sends a new message when messageID is 0.
+func (h *Handler) ShowSubscriptions(chatID int64, messageID int, user *tgbotapi.User) {
+	if h.refuseSubscriptions(chatID, user) {
+		return
+	}
+	var servers []telegram.SubscriptionItem
+	for serverURL := range h.supervisorClients {
+		if !roleFor(user, serverURL, "").Can(permissions.ActionView) {
+			continue
+		}
+		servers = append(servers, telegram.SubscriptionItem{
+			Label:     serverName(serverURL),
+			ServerURL: serverURL,
+			Chosen:    h.subscriptions.chose(user.ID, models.SubscriptionKey(serverURL, "")),
+		})
+	}
+	if len(servers) == 0 {
+		telegram.SendToTelegram(h.bot, chatID, "No servers to subscribe to\\.")
+		return
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ServerURL < servers[j].ServerURL })
+
+	message := "*Subscriptions*\n\nFailures of the servers, groups and processes marked ✅ are also sent to you privately\\. " +
+		"Tap a server to subscribe to all of it, or 📂 to pick groups and processes\\."
+	keyboard := telegram.ChooseServersKeyboard(servers)
+	if messageID == 0 {
+		telegram.SendToTelegramWithInlineKeyboard(h.bot, chatID, message, keyboard)
+		return
+	}
+	h.editMessage(chatID, messageID, message, keyboard)
+}
+
+// showServerSubscriptions edits a message into a page of the groups and
+// processes of a server, grouped processes under their group
+func (h *Handler) showServerSubscriptions(ctx context.Context, chatID int64, messageID int, user *tgbotapi.User, serverURL string, page int) {
+	processes, err := h.supervisorClients[serverURL].GetAllProcesses(ctx)
+	if err != nil {
+		telegram.SendToTelegram(h.bot, chatID, telegram.FormatClientError("fetching processes", serverURL, err))
+		return
+	}
+	sort.Slice(processes, func(i, j int) bool { return processes[i].FullName() < processes[j].FullName() })
+
+	groupSizes := make(map[string]int)
+	for _, process := range processes {
+		groupSizes[process.Group]++
+	}
+
+	var items []telegram.SubscriptionItem
+	item := func(label, target string) telegram.SubscriptionItem {
+		return telegram.SubscriptionItem{
+			Label:     label,
+			ServerURL: serverURL,
+			Target:    target,
+			Chosen:    h.subscriptions.chose(user.ID, models.SubscriptionKey(serverURL, target)),
+		}
+	}
+	for i, process := range processes {
+		if !roleFor(user, serverURL, process.Group).Can(permissions.ActionView) {
+			continue
+		}
+		if groupSizes[process.Group] > 1 {
+			if i == 0 || processes[i-1].Group != process.Group {
+				items = append(items, item("📁 "+process.Group, process.Group))
+			}
+			items = append(items, item("└ "+process.FullName(), process.FullName()))
+			continue
+		}
+		items = append(items, item(process.FullName(), process.FullName()))
+	}
+	if len(items) == 0 {
+		telegram.SendToTelegram(h.bot, chatID, "No processes to subscribe to\\.")
+		return
+	}
+
+	totalPages := (len(items) + telegram.SubscriptionsPerPage - 1) / telegram.SubscriptionsPerPage
+	page = max(1, min(page, totalPages))
+	message := fmt.Sprintf("*Subscriptions on* `%s`\n\nTap a group or process to subscribe to its failures\\.",
+		telegram.EscapeMarkdownV2(serverURL))
+	h.editMessage(chatID, messageID, message, telegram.ChooseProcessesKeyboard(serverURL, items, page))
+}
+
+// handleSubscriptionCallback handles "subs", which shows the server list or
+// a page of one server, and "sub", which toggles a subscription
+func (h *Handler) handleSubscriptionCallback(ctx context.Context, chatID int64, messageID int, user *tgbotapi.User, cb telegram.Callback) {
+	page, _ := strconv.Atoi(cb.Arg(0))
+	if cb.Action == "sub" {
+		group := ""
+		if cb.Target != "" {
+			group = processGroup(cb.Target)
+		}
+		if !h.permitted(chatID, user, permissions.ActionView, cb.ServerURL, group) {
+			return
+		}
+		key := models.SubscriptionKey(cb.ServerURL, cb.Target)
+		// Unsubscribing always works
+		if !h.subscriptions.chose(user.ID, key) && h.refuseSubscriptions(chatID, user) {
+			return
+		}
+		h.subscriptions.toggle(user.ID, key)
+		h.stateChanged()
+		h.saveState()
+	}
+
+	// Toggles from the server list carry page 0 and go back to it
+	if cb.ServerURL == "" || page == 0 {
+		h.ShowSubscriptions(chatID, messageID, user)
+		return
+	}
+	h.showServerSubscriptions(ctx, chatID, messageID, user, cb.ServerURL, page)
+}
+
+// refuseSubscriptions tells users who may not use the bot in a private chat,
+// where subscribed alerts go, that subscribing would get them nothing, and
+// reports whether it did
+func (h *Handler) refuseSubscriptions(chatID int64, user *tgbotapi.User) bool {
+	if isAllowed(user, user.ID) {
+		return false
+	}
+	telegram.SendToTelegram(h.bot, chatID, fmt.Sprintf("🔕 Subscribed alerts are sent to you in a private chat with the bot, "+
+		"which you are not allowed to use\\. Ask an admin to add your user ID `%d` to `ALLOWED_USER_IDS`\\.", user.ID))
+	return true
+}
+
+// notifySubscribers sends a process alert privately to every subscriber who
+// may still see the process, except in the main chat that already got it.
+// Each gets the alert buttons their role allows.
+func (h *Handler) notifySubscribers(serverURL string, process models.Process, message string) {
+	for _, chatID := range h.subscriptions.subscribers(serverURL, process) {
+		if chatID == config.TelegramChatID {
+			continue
+		}
+		user := &tgbotapi.User{ID: chatID}
+		role := roleFor(user, serverURL, process.Group)
+		if !isAllowed(user, chatID) || !role.Can(permissions.ActionView) {
+			continue
+		}
+		keyboard := telegram.BuildAlertKeyboard(serverURL, process.FullName(), role)
+		if err := telegram.SendToTelegramWithInlineKeyboard(h.bot, chatID, message, keyboard); err != nil {
+			log.Printf("Error sending alert to subscriber %d: %v", chatID, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/telegram"
+)
+
+func TestSubscribeNeedsPrivateChat(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	withAccessLists(t, []int64{60}, nil)
+	stranger := &tgbotapi.User{ID: 70}
+	sub := telegram.Callback{Action: "sub", ServerURL: server.URL, Args: []string{"0"}}
+
+	// Only allowed in the main chat, alerts could never reach them privately
+	sendCommand(h, stranger, "/subscribe")
+	pressAs(h, stranger, sub)
+	if refusals := tg.sent(testChatID, "which you are not allowed to use"); len(refusals) != 2 {
+		t.Errorf("got %d refusals, want 2", len(refusals))
+	}
+	if h.subscriptions.chose(stranger.ID, server.URL) {
+		t.Error("subscribed a user who can't get private alerts")
+	}
+
+	pressAs(h, &tgbotapi.User{ID: 60}, sub)
+	if !h.subscriptions.chose(60, server.URL) {
+		t.Error("ALLOWED_USER_IDS user could not subscribe")
+	}
+
+	// Subscriptions from before the user lost access can still be removed
+	h.subscriptions.restore([]models.User{{ChatID: stranger.ID, ChoosenProcesses: []string{server.URL}}})
+	pressAs(h, stranger, sub)
+	if h.subscriptions.chose(stranger.ID, server.URL) {
+		t.Error("could not unsubscribe")
+	}
+}
+
+func TestSubscribersGetAlerts(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	withAccessLists(t, []int64{60}, nil)
+	h.subscriptions.restore([]models.User{
+		{ChatID: 60, ChoosenProcesses: []string{server.URL}},
+		{ChatID: 70, ChoosenProcesses: []string{server.URL}},
+	})
+
+	server.SetState("web", "FATAL", 1)
+	h.CheckProcessStatuses(context.Background())
+	if alerts := tg.sent(60, "Process Status Change"); len(alerts) != 1 {
+		t.Errorf("subscriber got %d alerts, want 1", len(alerts))
+	}
+	if alerts := tg.sent(70, ""); len(alerts) != 0 {
+		t.Errorf("subscriber without access got %d messages, want none", len(alerts))
+	}
+}
+
+func TestSubscriberAlertButtonsFollowRole(t *testing.T) {
+	h, server, tg := newTestHandler(t)
+	// User 1 is an operator, 60 only views
+	withAccessLists(t, []int64{1, 60}, nil)
+	h.subscriptions.restore([]models.User{
+		{ChatID: 1, ChoosenProcesses: []string{server.URL}},
+		{ChatID: 60, ChoosenProcesses: []string{server.URL}},
+	})
+
+	server.SetState("web", "FATAL", 1)
+	h.CheckProcessStatuses(context.Background())
+
+	operator, viewer := tg.sent(1, "Process Status Change"), tg.sent(60, "Process Status Change")
+	if len(operator) != 1 || len(viewer) != 1 {
+		t.Fatalf("got %d and %d alerts, want 1 each", len(operator), len(viewer))
+	}
+	if !strings.Contains(operator[0].markup, "Stop") || !strings.Contains(operator[0].markup, "Snooze") {
+		t.Errorf("operator's alert buttons = %s, want Stop and Snooze", operator[0].markup)
+	}
+	for _, button := range []string{"Start", "Stop", "Snooze", "Mute"} {
+		if strings.Contains(viewer[0].markup, button) {
+			t.Errorf("viewer's alert buttons = %s, want no %s", viewer[0].markup, button)
+		}
+	}
+	if main := tg.sent(testChatID, "Process Status Change"); len(main) != 1 || !strings.Contains(main[0].markup, "Stop") {
+		t.Errorf("main chat alerts = %+v, want one with Stop", main)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
 )
 
 var (
@@ -15,6 +18,36 @@ var (
 	TelegramChatID     int64
 	SupervisorUsername string
 	SupervisorPassword string
+	LogTailLines       int
+	LogPageBytes       int
+	ServersFile        string
+	ConnectTimeout     time.Duration
+	CallTimeout        time.Duration
+	WaitTimeout        time.Duration
+	RetryAttempts      int
+	RetryBackoff       time.Duration
+	RetryMaxBackoff    time.Duration
+	BreakerThreshold   int
+	BreakerOpenTimeout time.Duration
+	Mode               string
+	PollInterval       time.Duration
+	EventsListenAddr   string
+	EventsToken        string
+	EventsForwardURL   string
+	EventsServerURL    string
+	AdminUserIDs       []int64
+	AllowedUserIDs     []int64
+	AllowedChatIDs     []int64
+	AdminChatID        int64
+	PermissionsFile    string
+	ConfirmTimeout     time.Duration
+	CallbackTTL        time.Duration
+	StateFile          string
+	SubscriptionsFile  string
+	AuditFile          string
+	DefaultRole        string
+	Permissions        *permissions.Policy
+	Servers            []ServerConfig
 )
 
 func init() {
@@ -29,6 +62,54 @@ func init() {
 	TelegramChatID = getEnvAsInt64("TELEGRAM_CHAT_ID", 0)
 	SupervisorUsername = getEnv("SUPERVISOR_USERNAME", "")
 	SupervisorPassword = getEnv("SUPERVISOR_PASSWORD", "")
+	LogTailLines = getEnvAsInt("LOG_TAIL_LINES", 30)
+	LogPageBytes = getEnvAsInt("LOG_PAGE_BYTES", 2000)
+	ServersFile = getEnv("SERVERS_FILE", "")
+	ConnectTimeout = getEnvAsDuration("SUPERVISOR_CONNECT_TIMEOUT", 5*time.Second)
+	CallTimeout = getEnvAsDuration("SUPERVISOR_CALL_TIMEOUT", 10*time.Second)
+	WaitTimeout = getEnvAsDuration("SUPERVISOR_WAIT_TIMEOUT", 2*time.Minute)
+	RetryAttempts = getEnvAsInt("SUPERVISOR_RETRY_ATTEMPTS", 3)
+	RetryBackoff = getEnvAsDuration("SUPERVISOR_RETRY_BACKOFF", 200*time.Millisecond)
+	RetryMaxBackoff = getEnvAsDuration("SUPERVISOR_RETRY_MAX_BACKOFF", 2*time.Second)
+	BreakerThreshold = getEnvAsInt("BREAKER_FAILURE_THRESHOLD", 5)
+	BreakerOpenTimeout = getEnvAsDuration("BREAKER_OPEN_TIMEOUT", 30*time.Second)
+	Mode = getEnv("MODE", "bot")
+	PollInterval = getEnvAsDuration("POLL_INTERVAL", time.Second)
+	EventsListenAddr = getEnv("EVENTS_LISTEN_ADDR", "")
+	EventsToken = getEnv("EVENTS_TOKEN", "")
+	EventsForwardURL = getEnv("EVENTS_FORWARD_URL", "")
+	EventsServerURL = getEnv("EVENTS_SERVER_URL", "")
+	AdminUserIDs = getEnvAsInt64List("ADMIN_USER_IDS")
+	AllowedUserIDs = getEnvAsInt64List("ALLOWED_USER_IDS")
+	AllowedChatIDs = getEnvAsInt64List("ALLOWED_CHAT_IDS")
+	AdminChatID = getEnvAsInt64("ADMIN_CHAT_ID", 0)
+	PermissionsFile = getEnv("PERMISSIONS_FILE", "")
+	DefaultRole = getEnv("DEFAULT_ROLE", "operator")
+	ConfirmTimeout = getEnvAsDuration("CONFIRM_TIMEOUT", 30*time.Second)
+	CallbackTTL = getEnvAsDuration("CALLBACK_TTL", 48*time.Hour)
+	StateFile = getEnv("STATE_FILE", "state.json")
+	SubscriptionsFile = getEnv("SUBSCRIPTIONS_FILE", "subscriptions.json")
+	AuditFile = getEnv("AUDIT_FILE", "audit.jsonl")
+
+	// Process lists are split into pages of this size
+	if ProcessesPerPage < 1 {
+		log.Printf("Ignoring invalid PROCESSES_PER_PAGE %d, showing 1 process per page", ProcessesPerPage)
+		ProcessesPerPage = 1
+	}
+
+	Servers, err = loadServers(ServersFile)
+	if err != nil {
+		log.Fatalf("Error loading servers: %v", err)
+	}
+
+	defaultRole, err := permissions.ParseRole(DefaultRole)
+	if err != nil {
+		log.Fatalf("Error parsing DEFAULT_ROLE: %v", err)
+	}
+	Permissions, err = permissions.Load(PermissionsFile, defaultRole, AdminUserIDs)
+	if err != nil {
+		log.Fatalf("Error loading permissions: %v", err)
+	}
 }
 
 func getEnv(key, defaultValue string) string {
@@ -53,3 +134,29 @@ func getEnvAsInt64(name string, defaultValue int64) int64 {
 	}
 	return defaultValue
 }
+
+func getEnvAsDuration(name string, defaultValue time.Duration) time.Duration {
+	valueStr := getEnv(name, "")
+	if value, err := time.ParseDuration(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsInt64List parses a comma separated list, skipping invalid entries
+func getEnvAsInt64List(name string) []int64 {
+	var values []int64
+	for _, field := range strings.Split(getEnv(name, ""), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			log.Printf("Ignoring invalid %s entry %q: %v", name, field, err)
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ServerConfig holds the connection settings of one supervisord server
+type ServerConfig struct {
+	URL                string   `json:"url"`
+	Username           string   `json:"username"`
+	Password           string   `json:"password"`
+	CAFile             string   `json:"ca_file"`
+	CertFile           string   `json:"cert_file"`
+	KeyFile            string   `json:"key_file"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify"`
+	ConnectTimeout     Duration `json:"connect_timeout"`
+	CallTimeout        Duration `json:"call_timeout"`
+	WaitTimeout        Duration `json:"wait_timeout"`
+	SkipConfirm        bool     `json:"skip_confirm"` // run destructive actions without asking, e.g. on staging
+}
+
+// Duration is a time.Duration written as "5s" or "1m30s" in JSON
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// loadServers reads per-server settings from the JSON file at path. Without a
+// file every URL in SERVER_URLS gets the global SUPERVISOR_USERNAME/PASSWORD.
+func loadServers(path string) ([]ServerConfig, error) {
+	if path == "" {
+		var servers []ServerConfig
+		for _, url := range strings.Split(ServerURLs, ",") {
+			url = strings.TrimSpace(url)
+			if url == "" {
+				continue
+			}
+			servers = append(servers, ServerConfig{
+				URL:            url,
+				Username:       SupervisorUsername,
+				Password:       SupervisorPassword,
+				ConnectTimeout: Duration{ConnectTimeout},
+				CallTimeout:    Duration{CallTimeout},
+				WaitTimeout:    Duration{WaitTimeout},
+			})
+		}
+		return servers, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read servers file: %w", err)
+	}
+
+	var servers []ServerConfig
+	if err := json.Unmarshal(data, &servers); err != nil {
+		return nil, fmt.Errorf("failed to parse servers file %s: %w", path, err)
+	}
+
+	for i := range servers {
+		if servers[i].URL == "" {
+			return nil, fmt.Errorf("server #%d in %s has no url", i+1, path)
+		}
+		// Servers without their own credentials fall back to the global pair
+		if servers[i].Username == "" && servers[i].Password == "" {
+			servers[i].Username = SupervisorUsername
+			servers[i].Password = SupervisorPassword
+		}
+		if servers[i].ConnectTimeout.Duration == 0 {
+			servers[i].ConnectTimeout.Duration = ConnectTimeout
+		}
+		if servers[i].CallTimeout.Duration == 0 {
+			servers[i].CallTimeout.Duration = CallTimeout
+		}
+		if servers[i].WaitTimeout.Duration == 0 {
+			servers[i].WaitTimeout.Duration = WaitTimeout
+		}
+	}
+	return servers, nil
+}
+
+// ServerByURL returns the settings of a configured server
+func ServerByURL(url string) (ServerConfig, bool) {
+	for _, server := range Servers {
+		if server.URL == url {
+			return server, true
+		}
+	}
+	return ServerConfig{}, false
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadServers(t *testing.T) {
+	prevURLs, prevUser, prevPass, prevCall := ServerURLs, SupervisorUsername, SupervisorPassword, CallTimeout
+	t.Cleanup(func() {
+		ServerURLs, SupervisorUsername, SupervisorPassword, CallTimeout = prevURLs, prevUser, prevPass, prevCall
+	})
+	ServerURLs = "http://a:9001/RPC2, http://b:9001/RPC2,"
+	SupervisorUsername, SupervisorPassword = "global", "pass"
+	CallTimeout = 10 * time.Second
+
+	servers, err := loadServers("")
+	if err != nil {
+		t.Fatalf("loadServers without a file: %v", err)
+	}
+	if len(servers) != 2 || servers[1].URL != "http://b:9001/RPC2" || servers[1].Username != "global" {
+		t.Errorf("servers from SERVER_URLS = %+v", servers)
+	}
+
+	path := filepath.Join(t.TempDir(), "servers.json")
+	file := `[
+		{"url": "https://prod:9001/RPC2", "username": "prod", "password": "secret",
+		 "ca_file": "/etc/ca.pem", "insecure_skip_verify": true, "call_timeout": "30s"},
+		{"url": "unix:///var/run/supervisor.sock"}
+	]`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	servers, err = loadServers(path)
+	if err != nil {
+		t.Fatalf("loadServers: %v", err)
+	}
+	prod, local := servers[0], servers[1]
+	if prod.Username != "prod" || prod.Password != "secret" || prod.CAFile != "/etc/ca.pem" || !prod.InsecureSkipVerify {
+		t.Errorf("prod = %+v, want its own credentials and TLS settings", prod)
+	}
+	if prod.CallTimeout.Duration != 30*time.Second {
+		t.Errorf("prod call timeout = %s, want 30s", prod.CallTimeout)
+	}
+	if local.Username != "global" || local.Password != "pass" || local.CallTimeout.Duration != CallTimeout {
+		t.Errorf("local = %+v, want the global credentials and timeouts", local)
+	}
+
+	for file, wantErr := range map[string]string{
+		`[{"username": "x"}]`:                        "has no url",
+		`[{"url": "http://a", "call_timeout": 5}]`:   "duration must be a string",
+		`[{"url": "http://a", "call_timeout": "5"}]`: "missing unit",
+		`{"url": "http://a"}`:                        "failed to parse",
+	} {
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadServers(path); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("loadServers(%s) error = %v, want %q", file, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package eventlistener
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Forwarder sends events to a central bot instance over HTTP
+type Forwarder struct {
+	URL    string
+	Token  string
+	client *http.Client
+}
+
+func NewForwarder(url, token string) *Forwarder {
+	return &Forwarder{
+		URL:    url,
+		Token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Forward posts the event as JSON. It can be used directly as a Handler.
+func (f *Forwarder) Forward(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create forward request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.Token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to forward event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to forward event: bad status code - %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// maxEventBytes caps the payload of an event read from supervisord and the
+// body of a forwarded one. Log events carry at most the capture buffer of a
+// process, which is far smaller.
+const maxEventBytes = 1 << 20
+
+// NewReceiver returns an HTTP handler accepting events posted by Forwarder.
+// Requests must carry the shared token, which may not be empty.
+func NewReceiver(token string, handle func(Event)) (http.Handler, error) {
+	if token == "" {
+		return nil, errors.New("a token is required to accept events")
+	}
+	expected := []byte("Bearer " + token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			log.Printf("Rejected event from %s: bad token", r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event Event
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventBytes)).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if event.ServerURL == "" {
+			http.Error(w, "event has no server_url", http.StatusBadRequest)
+			return
+		}
+
+		handle(event)
+		w.WriteHeader(http.StatusAccepted)
+	}), nil
+}
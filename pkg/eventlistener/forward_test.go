@@ -0,0 +1,52 @@
+package eventlistener
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForwardToReceiver(t *testing.T) {
+	if _, err := NewReceiver("", func(Event) {}); err == nil {
+		t.Fatal("NewReceiver accepted an empty token")
+	}
+
+	var received []Event
+	receiver, err := NewReceiver("secret", func(event Event) { received = append(received, event) })
+	if err != nil {
+		t.Fatalf("NewReceiver: %v", err)
+	}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	event := Event{ServerURL: "http://web1:9001/RPC2", Name: "PROCESS_STATE_FATAL", Payload: map[string]string{"processname": "web"}}
+	if err := NewForwarder(srv.URL, "secret").Forward(event); err != nil {
+		t.Fatalf("Forward: %v", err)
+	}
+	if len(received) != 1 || received[0].ServerURL != event.ServerURL || received[0].ProcessName() != "web" {
+		t.Fatalf("received %+v, want %+v", received, event)
+	}
+
+	if err := NewForwarder(srv.URL, "wrong").Forward(event); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Forward with a wrong token: error = %v, want 401", err)
+	}
+	if err := NewForwarder(srv.URL, "secret").Forward(Event{Name: "TICK_5"}); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Forward without server: error = %v, want 400", err)
+	}
+
+	big := `{"server_url":"x","data":"` + strings.Repeat("a", maxEventBytes) + `"}`
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(big))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("posting a large event: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("large event: status %d, want 400", resp.StatusCode)
+	}
+	if len(received) != 1 {
+		t.Errorf("received %d events, want only the valid one", len(received))
+	}
+}
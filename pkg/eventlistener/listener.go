@@ -0,0 +1,129 @@
+// Package eventlistener implements the supervisord event listener protocol,
+// letting the notifier run as an [eventlistener:x] program.
+package eventlistener
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Event is one notification received from supervisord
+type Event struct {
+	ServerURL string            `json:"server_url"` // server the event came from
+	Name      string            `json:"name"`       // e.g. PROCESS_STATE_FATAL
+	Headers   map[string]string `json:"headers"`    // ver, server, serial, pool, ...
+	Payload   map[string]string `json:"payload"`    // processname, groupname, from_state, ...
+	Data      string            `json:"data"`       // log output of PROCESS_LOG_* events
+}
+
+// IsProcessState reports whether the event is a PROCESS_STATE_* event
+func (e Event) IsProcessState() bool {
+	return strings.HasPrefix(e.Name, "PROCESS_STATE_")
+}
+
+// IsProcessLog reports whether the event is a PROCESS_LOG_* event
+func (e Event) IsProcessLog() bool {
+	return strings.HasPrefix(e.Name, "PROCESS_LOG_")
+}
+
+// State returns the state a PROCESS_STATE_* event moved the process to
+func (e Event) State() string {
+	return strings.TrimPrefix(e.Name, "PROCESS_STATE_")
+}
+
+// Stream returns "stdout" or "stderr" for PROCESS_LOG_* events
+func (e Event) Stream() string {
+	return strings.ToLower(strings.TrimPrefix(e.Name, "PROCESS_LOG_"))
+}
+
+func (e Event) ProcessName() string {
+	return e.Payload["processname"]
+}
+
+func (e Event) GroupName() string {
+	return e.Payload["groupname"]
+}
+
+// Handler processes one event. Returning an error makes supervisord keep the
+// event and send it again later.
+type Handler func(Event) error
+
+// Run speaks the listener protocol on in/out until in is closed: it announces
+// READY, reads one event, hands it to handle and acknowledges it. serverURL is
+// stored on every event to tell servers apart when events are forwarded.
+func Run(in io.Reader, out io.Writer, serverURL string, handle Handler) error {
+	reader := bufio.NewReader(in)
+
+	for {
+		if _, err := io.WriteString(out, "READY\n"); err != nil {
+			return fmt.Errorf("failed to announce READY: %w", err)
+		}
+
+		event, err := readEvent(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		event.ServerURL = serverURL
+
+		result := "OK"
+		if err := handle(event); err != nil {
+			log.Printf("Error handling %s event: %v", event.Name, err)
+			result = "FAIL"
+		}
+		if _, err := fmt.Fprintf(out, "RESULT %d\n%s", len(result), result); err != nil {
+			return fmt.Errorf("failed to send RESULT: %w", err)
+		}
+	}
+}
+
+// readEvent reads a header line and its payload
+func readEvent(reader *bufio.Reader) (Event, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line == "" {
+			return Event{}, io.EOF
+		}
+		return Event{}, fmt.Errorf("failed to read event header: %w", err)
+	}
+
+	headers := parseTokens(strings.TrimSpace(line))
+	length, err := strconv.Atoi(headers["len"])
+	if err != nil {
+		return Event{}, fmt.Errorf("invalid event header %q: %w", line, err)
+	}
+	if length < 0 || length > maxEventBytes {
+		return Event{}, fmt.Errorf("invalid event header %q: length must be between 0 and %d", line, maxEventBytes)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return Event{}, fmt.Errorf("failed to read event payload: %w", err)
+	}
+
+	// Log events carry their tokens on the first line and the output after it
+	tokens, data, _ := strings.Cut(string(body), "\n")
+	return Event{
+		Name:    headers["eventname"],
+		Headers: headers,
+		Payload: parseTokens(tokens),
+		Data:    data,
+	}, nil
+}
+
+// parseTokens splits "key:value key:value" into a map
+func parseTokens(line string) map[string]string {
+	tokens := make(map[string]string)
+	for _, field := range strings.Fields(line) {
+		if key, value, ok := strings.Cut(field, ":"); ok {
+			tokens[key] = value
+		}
+	}
+	return tokens
+}
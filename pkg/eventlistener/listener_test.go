@@ -0,0 +1,108 @@
+package eventlistener
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// frame wraps a payload in a supervisord event header
+func frame(name, payload string) string {
+	return fmt.Sprintf("ver:3.0 server:web1 serial:21 pool:notifier poolserial:10 eventname:%s len:%d\n%s",
+		name, len(payload), payload)
+}
+
+func TestReadEvent(t *testing.T) {
+	state := "processname:web groupname:web from_state:RUNNING expected:0 pid:2766"
+	output := "processname:web groupname:web channel:stdout pid:2766\nline one\nline two\n"
+
+	tests := []struct {
+		name    string
+		input   string
+		want    Event
+		wantErr string
+	}{
+		{
+			name:  "state event",
+			input: frame("PROCESS_STATE_EXITED", state),
+			want: Event{Name: "PROCESS_STATE_EXITED", Payload: map[string]string{
+				"processname": "web", "groupname": "web", "from_state": "RUNNING", "expected": "0", "pid": "2766",
+			}},
+		},
+		{
+			name:  "log event keeps its output",
+			input: frame("PROCESS_LOG_STDOUT", output),
+			want: Event{Name: "PROCESS_LOG_STDOUT", Payload: map[string]string{
+				"processname": "web", "groupname": "web", "channel": "stdout", "pid": "2766",
+			}, Data: "line one\nline two\n"},
+		},
+		{name: "missing length", input: "ver:3.0 eventname:TICK_5\n", wantErr: "invalid event header"},
+		{name: "bad length", input: "ver:3.0 eventname:TICK_5 len:x\n", wantErr: "invalid event header"},
+		{name: "negative length", input: "ver:3.0 eventname:TICK_5 len:-1\n", wantErr: "invalid event header"},
+		{name: "oversized length", input: fmt.Sprintf("ver:3.0 eventname:TICK_5 len:%d\n", maxEventBytes+1), wantErr: "invalid event header"},
+		{name: "short payload", input: "eventname:TICK_5 len:10\nwhen:1", wantErr: "failed to read event payload"},
+		{name: "cut header", input: "eventname:TICK_5 len", wantErr: "failed to read event header"},
+	}
+	for _, tt := range tests {
+		got, err := readEvent(bufio.NewReader(strings.NewReader(tt.input)))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if got.Name != tt.want.Name || got.Data != tt.want.Data || fmt.Sprint(got.Payload) != fmt.Sprint(tt.want.Payload) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if got.Headers["server"] != "web1" || got.Headers["serial"] != "21" {
+			t.Errorf("%s: headers = %v", tt.name, got.Headers)
+		}
+	}
+
+	if _, err := readEvent(bufio.NewReader(strings.NewReader(""))); err != io.EOF {
+		t.Errorf("empty input: error = %v, want io.EOF", err)
+	}
+}
+
+// Events follow each other without separators, the length must be honoured
+func TestRunFraming(t *testing.T) {
+	input := frame("PROCESS_STATE_FATAL", "processname:a groupname:a from_state:BACKOFF") +
+		frame("PROCESS_LOG_STDERR", "processname:b groupname:b channel:stderr\nlen:99 eventname:FAKE\n") +
+		frame("PROCESS_STATE_RUNNING", "processname:c groupname:c from_state:STARTING pid:1")
+
+	var events []Event
+	var out strings.Builder
+	err := Run(strings.NewReader(input), &out, "http://web1:9001/RPC2", func(event Event) error {
+		events = append(events, event)
+		if event.ProcessName() == "b" {
+			return errors.New("try again")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var names []string
+	for _, event := range events {
+		names = append(names, event.Name+"/"+event.ProcessName()+"/"+event.ServerURL)
+	}
+	want := "PROCESS_STATE_FATAL/a/http://web1:9001/RPC2 PROCESS_LOG_STDERR/b/http://web1:9001/RPC2 PROCESS_STATE_RUNNING/c/http://web1:9001/RPC2"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+	if events[1].Data != "len:99 eventname:FAKE\n" {
+		t.Errorf("log data = %q", events[1].Data)
+	}
+	wantOut := "READY\nRESULT 2\nOKREADY\nRESULT 4\nFAILREADY\nRESULT 2\nOKREADY\n"
+	if out.String() != wantOut {
+		t.Errorf("protocol output = %q, want %q", out.String(), wantOut)
+	}
+}
@@ -41,7 +41,7 @@ func Log(folder string, msg ...interface{}) {
 	}(file)
 
 	log.SetOutput(file)
-	log.Println(msg)
+	log.Println(msg...)
 	log.SetOutput(os.Stdout)
 
 	go cleanUpLogs(folder)
@@ -1,14 +1,142 @@
 package models
 
+import "time"
+
 type Process struct {
-	Name        string
-	State       string
-	Description string
-	ServerURL   string
-	Group       string
+	Name          string
+	State         string
+	Description   string
+	ServerURL     string
+	Group         string
+	Pid           int
+	Start         time.Time // when the process was last started
+	Stop          time.Time // when the process last ended, zero if never
+	Now           time.Time // supervisord's clock when the info was fetched
+	ExitStatus    int
+	SpawnErr      string
+	StdoutLogfile string
+	StderrLogfile string
+}
+
+// FullName returns the "group:name" form supervisor expects for processes
+// whose group differs from their name
+func (p Process) FullName() string {
+	if p.Group == "" || p.Group == p.Name {
+		return p.Name
+	}
+	return p.Group + ":" + p.Name
+}
+
+// Matches reports whether name refers to this process, either by its plain
+// name or by its "group:name" form
+func (p Process) Matches(name string) bool {
+	return p.Name == name || p.FullName() == name
+}
+
+// Uptime returns how long a running process has been up, or how long it ran
+// the last time for a process that has ended
+func (p Process) Uptime() time.Duration {
+	if p.Start.IsZero() {
+		return 0
+	}
+	if p.State == "RUNNING" {
+		return p.Now.Sub(p.Start)
+	}
+	if p.Stop.After(p.Start) {
+		return p.Stop.Sub(p.Start)
+	}
+	return 0
 }
 
+// User is a Telegram user's alert subscriptions. ChoosenProcesses holds
+// subscription keys for whole servers, groups and processes.
 type User struct {
-	ChatID           int64
-	ChoosenProcesses []string
+	ChatID           int64    `json:"chat_id"`
+	ChoosenProcesses []string `json:"choosen_processes"`
+}
+
+// SubscriptionKey identifies a server when target is empty, otherwise a group
+// or a process in its "group:name" form on that server
+func SubscriptionKey(serverURL, target string) string {
+	if target == "" {
+		return serverURL
+	}
+	return serverURL + "|" + target
+}
+
+// Chose reports whether key is among the user's subscriptions
+func (u *User) Chose(key string) bool {
+	for _, chosen := range u.ChoosenProcesses {
+		if chosen == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Toggle adds key to the subscriptions or removes it, returning whether the
+// user is subscribed afterwards
+func (u *User) Toggle(key string) bool {
+	for i, chosen := range u.ChoosenProcesses {
+		if chosen == key {
+			u.ChoosenProcesses = append(u.ChoosenProcesses[:i], u.ChoosenProcesses[i+1:]...)
+			return false
+		}
+	}
+	u.ChoosenProcesses = append(u.ChoosenProcesses, key)
+	return true
+}
+
+// SubscribedTo reports whether the user chose the process, its group or the
+// server it runs on
+func (u *User) SubscribedTo(serverURL string, process Process) bool {
+	return u.Chose(SubscriptionKey(serverURL, "")) ||
+		u.Chose(SubscriptionKey(serverURL, process.Group)) ||
+		u.Chose(SubscriptionKey(serverURL, process.FullName()))
+}
+
+// Mute silences the alerts of one process until Until, or until the process
+// is seen RUNNING again when Until is zero
+type Mute struct {
+	ServerURL string    `json:"server_url"`
+	Process   string    `json:"process"` // "group:name" form
+	Until     time.Time `json:"until"`
+	By        string    `json:"by"` // who muted it
+}
+
+// UntilFixed reports whether the mute lasts until the process runs again
+func (m Mute) UntilFixed() bool {
+	return m.Until.IsZero()
+}
+
+// Active reports whether the mute still silences alerts at now
+func (m Mute) Active(now time.Time) bool {
+	return m.UntilFixed() || now.Before(m.Until)
+}
+
+// ProcessConfig is the configuration of a process as reported by supervisord
+type ProcessConfig struct {
+	Name          string
+	Group         string
+	Command       string
+	Directory     string
+	Autostart     bool
+	Autorestart   string // "true", "false" or "unexpected"
+	StartSecs     int
+	StartRetries  int
+	StopSignal    string
+	StopWaitSecs  int
+	Priority      int
+	StdoutLogfile string
+	StderrLogfile string
+	InUse         bool // false once removed from the config but still running
+}
+
+// FullName returns the name supervisord knows the process by, like
+// Process.FullName
+func (c ProcessConfig) FullName() string {
+	if c.Group == "" || c.Group == c.Name {
+		return c.Name
+	}
+	return c.Group + ":" + c.Name
 }
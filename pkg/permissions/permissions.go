@@ -0,0 +1,178 @@
+// Package permissions decides what a Telegram user may do on which server
+// and process group.
+package permissions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Role is a level of access, each role includes the ones below it
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleNone:     "none",
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// ParseRole parses "none", "viewer", "operator" or "admin"
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q", name)
+}
+
+func (r *Role) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	role, err := ParseRole(name)
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// Action is something a user does through the bot
+type Action int
+
+const (
+	// ActionView covers process details, logs, configs and summaries
+	ActionView Action = iota
+	// ActionControl covers starting, stopping, restarting and signalling
+	ActionControl
+	// ActionAdmin covers config reloads, writing stdin and clearing logs
+	ActionAdmin
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionControl:
+		return "control processes"
+	case ActionAdmin:
+		return "administer servers"
+	default:
+		return "view processes"
+	}
+}
+
+// Can reports whether the role permits the action
+func (r Role) Can(action Action) bool {
+	switch action {
+	case ActionView:
+		return r >= RoleViewer
+	case ActionControl:
+		return r >= RoleOperator
+	default:
+		return r >= RoleAdmin
+	}
+}
+
+// Grant gives a user a role, optionally only on one server and one group
+type Grant struct {
+	Role   Role   `json:"role"`
+	Server string `json:"server"` // server URL, empty for every server
+	Group  string `json:"group"`  // process group, empty for every group
+}
+
+// Policy maps users to their grants
+type Policy struct {
+	DefaultRole Role // role of users without grants
+	Users       map[int64][]Grant
+	Admins      []int64 // admins on every server
+}
+
+// RoleFor returns the highest role the user holds on a server and group.
+// An empty group asks for the whole server, which only unscoped grants give.
+func (p *Policy) RoleFor(userID int64, serverURL, group string) Role {
+	for _, admin := range p.Admins {
+		if admin == userID {
+			return RoleAdmin
+		}
+	}
+
+	grants, ok := p.Users[userID]
+	if !ok {
+		return p.DefaultRole
+	}
+	role := RoleNone
+	for _, grant := range grants {
+		if grant.Server != "" && grant.Server != serverURL {
+			continue
+		}
+		if grant.Group != "" && grant.Group != group {
+			continue
+		}
+		if grant.Role > role {
+			role = grant.Role
+		}
+	}
+	return role
+}
+
+// HasUser reports whether the user has any grant
+func (p *Policy) HasUser(userID int64) bool {
+	_, ok := p.Users[userID]
+	return ok
+}
+
+// Load reads a policy from the JSON file at path:
+//
+//	{
+//	  "default_role": "viewer",
+//	  "users": {
+//	    "123456": [{"role": "operator", "server": "http://prod-1:9001/RPC2", "group": "billing"}]
+//	  }
+//	}
+//
+// Without a file every user gets defaultRole.
+func Load(path string, defaultRole Role, admins []int64) (*Policy, error) {
+	policy := &Policy{DefaultRole: defaultRole, Users: make(map[int64][]Grant), Admins: admins}
+	if path == "" {
+		return policy, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read permissions file: %w", err)
+	}
+	var file struct {
+		DefaultRole *Role              `json:"default_role"`
+		Users       map[string][]Grant `json:"users"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse permissions file %s: %w", path, err)
+	}
+
+	if file.DefaultRole != nil {
+		policy.DefaultRole = *file.DefaultRole
+	}
+	for key, grants := range file.Users {
+		userID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID %q in %s: %w", key, path, err)
+		}
+		policy.Users[userID] = grants
+	}
+	return policy, nil
+}
@@ -0,0 +1,114 @@
+package permissions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRoleFor(t *testing.T) {
+	const prod, staging = "http://prod:9001/RPC2", "http://staging:9001/RPC2"
+	policy := &Policy{
+		DefaultRole: RoleViewer,
+		Admins:      []int64{1},
+		Users: map[int64][]Grant{
+			1: {{Role: RoleNone}},
+			2: {{Role: RoleOperator}},
+			3: {{Role: RoleViewer}, {Role: RoleOperator, Server: prod, Group: "billing"}},
+			4: {{Role: RoleAdmin, Server: staging}},
+			5: {{Role: RoleNone}},
+			6: {},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		user   int64
+		server string
+		group  string
+		want   Role
+	}{
+		{name: "admin over own grants", user: 1, server: prod, group: "web", want: RoleAdmin},
+		{name: "admin server-wide", user: 1, server: staging, want: RoleAdmin},
+		{name: "unscoped grant", user: 2, server: prod, group: "web", want: RoleOperator},
+		{name: "unscoped grant server-wide", user: 2, server: staging, want: RoleOperator},
+		{name: "group grant on its group", user: 3, server: prod, group: "billing", want: RoleOperator},
+		{name: "group grant on another group", user: 3, server: prod, group: "web", want: RoleViewer},
+		{name: "group grant on another server", user: 3, server: staging, group: "billing", want: RoleViewer},
+		{name: "group grant server-wide", user: 3, server: prod, want: RoleViewer},
+		{name: "server grant on its server", user: 4, server: staging, group: "web", want: RoleAdmin},
+		{name: "server grant on another server", user: 4, server: prod, group: "web", want: RoleNone},
+		{name: "explicit none", user: 5, server: prod, want: RoleNone},
+		{name: "listed without grants", user: 6, server: prod, want: RoleNone},
+		{name: "unlisted user gets the default", user: 7, server: prod, group: "web", want: RoleViewer},
+	}
+	for _, tt := range tests {
+		if got := policy.RoleFor(tt.user, tt.server, tt.group); got != tt.want {
+			t.Errorf("%s: RoleFor(%d, %q, %q) = %s, want %s", tt.name, tt.user, tt.server, tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string // contents, empty for no file
+		wantErr string
+		user    int64
+		want    Role
+	}{
+		{name: "no file", user: 2, want: RoleViewer},
+		{name: "admins need no grants", user: 1, want: RoleAdmin},
+		{name: "grant", file: `{"users": {"2": [{"role": "operator"}]}}`, user: 2, want: RoleOperator},
+		{name: "default from the file", file: `{"default_role": "none", "users": {}}`, user: 3, want: RoleNone},
+		{name: "default kept without one in the file", file: `{"users": {"2": [{"role": "admin"}]}}`, user: 3, want: RoleViewer},
+		{name: "unknown role", file: `{"users": {"2": [{"role": "root"}]}}`, wantErr: `unknown role "root"`},
+		{name: "unknown default role", file: `{"default_role": "owner"}`, wantErr: `unknown role "owner"`},
+		{name: "role of the wrong type", file: `{"users": {"2": [{"role": 3}]}}`, wantErr: "failed to parse"},
+		{name: "user ID not a number", file: `{"users": {"alice": [{"role": "viewer"}]}}`, wantErr: `invalid user ID "alice"`},
+		{name: "broken JSON", file: `{"users": `, wantErr: "failed to parse"},
+	}
+	for _, tt := range tests {
+		path := ""
+		if tt.file != "" {
+			path = filepath.Join(t.TempDir(), "permissions.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		policy, err := Load(path, RoleViewer, []int64{1})
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: Load error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Load error = %v", tt.name, err)
+			continue
+		}
+		if got := policy.RoleFor(tt.user, "http://prod:9001/RPC2", "web"); got != tt.want {
+			t.Errorf("%s: RoleFor(%d) = %s, want %s", tt.name, tt.user, got, tt.want)
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json"), RoleViewer, nil); err == nil {
+		t.Error("Load of a missing file succeeded")
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, name := range []string{"none", "viewer", "operator", "admin"} {
+		role, err := ParseRole(name)
+		if err != nil || role.String() != name {
+			t.Errorf("ParseRole(%q) = %s, %v", name, role, err)
+		}
+	}
+	for _, name := range []string{"", "Admin", "root"} {
+		if _, err := ParseRole(name); err == nil {
+			t.Errorf("ParseRole(%q) succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+)
+
+// State is what the monitor remembers across restarts
+type State struct {
+	SavedAt       time.Time              `json:"saved_at"`
+	Servers       map[string]ServerState `json:"servers"` // by server URL
+	Mutes         []models.Mute          `json:"mutes"`
+	Subscriptions []models.User          `json:"subscriptions"`
+	Buttons       []Button               `json:"buttons"`
+}
+
+// Button is the callback behind the token of an inline button
+type Button struct {
+	Token     string    `json:"token"`
+	Action    string    `json:"action"`
+	ServerURL string    `json:"server_url,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Args      []string  `json:"args,omitempty"`
+	Expires   time.Time `json:"expires"`
+}
+
+// ServerState is the last seen state of one server's processes
+type ServerState struct {
+	Processes   map[string]string `json:"processes"`    // state by "group:name"
+	UserStopped []string          `json:"user_stopped"` // processes stopped from the bot
+}
+
+// Store loads and saves the monitor state
+type Store interface {
+	Load() (State, error)
+	Save(State) error
+}
+
+// FileStore keeps the state in a JSON file
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load reads the state file. A missing file is an empty state.
+func (s *FileStore) Load() (State, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("failed to read state file: %w", err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, fmt.Errorf("failed to parse state file %s: %w", s.path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state through a temporary file, so a crash mid-write
+// leaves the previous state in place
+func (s *FileStore) Save(state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Discard is a Store that remembers nothing
+type Discard struct{}
+
+func (Discard) Load() (State, error) { return State{}, nil }
+func (Discard) Save(State) error     { return nil }
+
+// Change is a process whose state differs between a saved snapshot and the
+// live server. From is empty for new processes, To for removed ones.
+type Change struct {
+	Process string
+	From    string
+	To      string
+}
+
+// Diff compares the saved processes of a server with the live ones
+func Diff(saved, live map[string]string) []Change {
+	var changes []Change
+	for process, to := range live {
+		if from := saved[process]; from != to {
+			changes = append(changes, Change{Process: process, From: from, To: to})
+		}
+	}
+	for process, from := range saved {
+		if _, ok := live[process]; !ok {
+			changes = append(changes, Change{Process: process, From: from})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Process < changes[j].Process })
+	return changes
+}
@@ -0,0 +1,86 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		saved, live map[string]string
+		want        []Change
+	}{
+		{name: "unchanged", saved: map[string]string{"web": "RUNNING"}, live: map[string]string{"web": "RUNNING"}},
+		{name: "empty", saved: nil, live: nil},
+		{
+			name:  "state changes",
+			saved: map[string]string{"web": "RUNNING", "worker": "STOPPED"},
+			live:  map[string]string{"web": "FATAL", "worker": "RUNNING"},
+			want:  []Change{{Process: "web", From: "RUNNING", To: "FATAL"}, {Process: "worker", From: "STOPPED", To: "RUNNING"}},
+		},
+		{
+			name:  "added and removed",
+			saved: map[string]string{"old": "RUNNING", "web": "RUNNING"},
+			live:  map[string]string{"new": "STARTING", "web": "RUNNING"},
+			want:  []Change{{Process: "new", To: "STARTING"}, {Process: "old", From: "RUNNING"}},
+		},
+		{
+			name: "everything new after a first start",
+			live: map[string]string{"b": "RUNNING", "a": "EXITED"},
+			want: []Change{{Process: "a", To: "EXITED"}, {Process: "b", To: "RUNNING"}},
+		},
+	}
+	for _, tt := range tests {
+		if got := Diff(tt.saved, tt.live); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Diff = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewFileStore(path)
+
+	empty, err := store.Load()
+	if err != nil || !reflect.DeepEqual(empty, State{}) {
+		t.Fatalf("Load of a missing file = %+v, %v, want an empty state", empty, err)
+	}
+
+	saved := State{
+		SavedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Servers: map[string]ServerState{
+			"http://web1:9001/RPC2": {Processes: map[string]string{"web:web_01": "RUNNING"}, UserStopped: []string{"worker"}},
+		},
+		Mutes: []models.Mute{{ServerURL: "http://web1:9001/RPC2", Process: "worker", By: "@alice",
+			Until: time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)}},
+		Subscriptions: []models.User{{ChatID: 42, ChoosenProcesses: []string{"http://web1:9001/RPC2"}}},
+		Buttons: []Button{{Token: "abcdefghijklmnop", Action: "log", ServerURL: "http://web1:9001/RPC2", Target: "web:web_01",
+			Args: []string{"out", "-1"}, Expires: time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)}},
+	}
+	if err := store.Save(saved); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("Load = %+v, want %+v", loaded, saved)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); err == nil {
+		t.Error("Load of a corrupt file succeeded")
+	}
+}
@@ -0,0 +1,119 @@
+package supervisor
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a client's circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails calls immediately with ErrBreakerOpen
+	BreakerOpen
+	// BreakerHalfOpen lets one probe call through to test the server
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// ErrBreakerOpen is returned without contacting the server while its circuit
+// breaker is open
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// BreakerOptions configures the circuit breaker of a Client
+type BreakerOptions struct {
+	FailureThreshold int           // consecutive failed calls that open the breaker, 0 disables it
+	OpenTimeout      time.Duration // how long to wait before probing an open breaker
+}
+
+// breaker stops calls to a server after repeated failures and lets a single
+// probe through once OpenTimeout has passed
+type breaker struct {
+	opts BreakerOptions
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(opts BreakerOptions) *breaker {
+	return &breaker{opts: opts}
+}
+
+// allow reports whether a call may go to the server now
+func (b *breaker) allow() bool {
+	if b.opts.FailureThreshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.opts.OpenTimeout {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		// Only the one probe is let through
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of an allowed call
+func (b *breaker) record(failed bool) {
+	if b.opts.FailureThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.opts.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release gives up an allowed call without an outcome, e.g. when the caller
+// cancelled it
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) currentState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,87 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		op        string // "allow", "fail", "ok", "release" or "wait"
+		wantAllow bool
+		wantState BreakerState
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{name: "opens after the threshold", steps: []step{
+			{op: "fail", wantState: BreakerClosed},
+			{op: "fail", wantState: BreakerClosed},
+			{op: "fail", wantState: BreakerOpen},
+			{op: "allow", wantAllow: false, wantState: BreakerOpen},
+		}},
+		{name: "success resets the count", steps: []step{
+			{op: "fail", wantState: BreakerClosed},
+			{op: "fail", wantState: BreakerClosed},
+			{op: "ok", wantState: BreakerClosed},
+			{op: "fail", wantState: BreakerClosed},
+			{op: "fail", wantState: BreakerClosed},
+			{op: "allow", wantAllow: true, wantState: BreakerClosed},
+		}},
+		{name: "one probe after the timeout closes it", steps: []step{
+			{op: "fail"}, {op: "fail"}, {op: "fail", wantState: BreakerOpen},
+			{op: "wait", wantState: BreakerOpen},
+			{op: "allow", wantAllow: true, wantState: BreakerHalfOpen},
+			{op: "allow", wantAllow: false, wantState: BreakerHalfOpen},
+			{op: "ok", wantState: BreakerClosed},
+			{op: "allow", wantAllow: true, wantState: BreakerClosed},
+		}},
+		{name: "a failed probe opens it again", steps: []step{
+			{op: "fail"}, {op: "fail"}, {op: "fail", wantState: BreakerOpen},
+			{op: "wait", wantState: BreakerOpen},
+			{op: "allow", wantAllow: true, wantState: BreakerHalfOpen},
+			{op: "fail", wantState: BreakerOpen},
+			{op: "allow", wantAllow: false, wantState: BreakerOpen},
+		}},
+		{name: "a released probe lets the next one through", steps: []step{
+			{op: "fail"}, {op: "fail"}, {op: "fail", wantState: BreakerOpen},
+			{op: "wait", wantState: BreakerOpen},
+			{op: "allow", wantAllow: true, wantState: BreakerHalfOpen},
+			{op: "release", wantState: BreakerHalfOpen},
+			{op: "allow", wantAllow: true, wantState: BreakerHalfOpen},
+		}},
+	}
+	for _, tt := range tests {
+		b := newBreaker(BreakerOptions{FailureThreshold: 3, OpenTimeout: time.Minute})
+		for i, s := range tt.steps {
+			switch s.op {
+			case "allow":
+				if got := b.allow(); got != s.wantAllow {
+					t.Errorf("%s: step %d: allow() = %v, want %v", tt.name, i, got, s.wantAllow)
+				}
+			case "fail", "ok":
+				b.record(s.op == "fail")
+			case "release":
+				b.release()
+			case "wait":
+				b.mu.Lock()
+				b.openedAt = b.openedAt.Add(-time.Minute)
+				b.mu.Unlock()
+			}
+			if got := b.currentState(); got != s.wantState {
+				t.Errorf("%s: step %d (%s): state %s, want %s", tt.name, i, s.op, got, s.wantState)
+			}
+		}
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreaker(BreakerOptions{})
+	for i := 0; i < 10; i++ {
+		b.record(true)
+	}
+	if !b.allow() || b.currentState() != BreakerClosed {
+		t.Errorf("disabled breaker stopped calls, state %s", b.currentState())
+	}
+}
@@ -1,10 +1,20 @@
 package supervisor
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/kolo/xmlrpc"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
@@ -16,9 +26,47 @@ type BasicAuth struct {
 	Password string
 }
 
+// TLSOptions configures HTTPS connections to supervisord
+type TLSOptions struct {
+	CAFile             string // PEM bundle used instead of the system roots
+	CertFile           string // client certificate, requires KeyFile
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// Options configures how a Client connects to its server
+type Options struct {
+	Auth           *BasicAuth
+	TLS            *TLSOptions
+	ConnectTimeout time.Duration // limit for establishing a connection, 0 means none
+	CallTimeout    time.Duration // limit for a whole XML-RPC call, 0 means none
+	WaitTimeout    time.Duration // limit for calls waiting for processes to start or stop, 0 means none
+	Retry          RetryOptions
+	Breaker        BreakerOptions
+}
+
+// RetryOptions configures retries of failed calls with exponential backoff.
+// Calls are only retried when the server may not have acted on them: on
+// connection failures, or on any transient error for read-only calls.
+type RetryOptions struct {
+	Attempts       int           // total attempts per call, 0 or 1 disables retries
+	InitialBackoff time.Duration // wait before the first retry, doubled after each one
+	MaxBackoff     time.Duration // upper bound for the wait, 0 means none
+}
+
+// ErrTimeout is wrapped by errors of calls that ran out of time, so callers
+// can tell a hung or unreachable server apart from an XML-RPC failure
+var ErrTimeout = errors.New("server timed out")
+
 type Client struct {
-	xmlrpc *xmlrpc.Client
-	auth   *BasicAuth
+	url         string
+	httpClient  *http.Client
+	transport   *http.Transport
+	auth        *BasicAuth
+	callTimeout time.Duration
+	waitTimeout time.Duration
+	retry       RetryOptions
+	breaker     *breaker
 }
 
 // encodeBasicAuth creates Base64 encoded auth string
@@ -27,29 +75,91 @@ func encodeBasicAuth(username, password string) string {
 	return base64.StdEncoding.EncodeToString([]byte(auth))
 }
 
-// NewClient creates supervisor client with basic auth
-func NewClient(serverURL string, auth *BasicAuth) (*Client, error) {
+// unixScheme prefixes server URLs that point at a supervisord unix socket,
+// e.g. unix:///var/run/supervisor.sock
+const unixScheme = "unix://"
+
+// NewClient creates supervisor client with basic auth and TLS settings
+func NewClient(serverURL string, opts Options) (*Client, error) {
 	// Create custom transport
-	transport := &http.Transport{}
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: opts.ConnectTimeout,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if opts.TLS != nil {
+		tlsConfig, err := buildTLSConfig(opts.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	// Socket servers speak the same XML-RPC over HTTP, only the connection
+	// goes to the socket file instead of a TCP address
+	rpcURL := serverURL
+	if strings.HasPrefix(serverURL, unixScheme) {
+		socketPath := strings.TrimPrefix(serverURL, unixScheme)
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+		rpcURL = "http://localhost/RPC2"
+	}
 
 	// Create custom RoundTripper to add auth header
 	authTransport := &authRoundTripper{
 		base: transport,
-		auth: auth,
+		auth: opts.Auth,
 	}
 
-	// Create XML-RPC client with auth transport
-	client, err := xmlrpc.NewClient(serverURL, authTransport)
-	if err != nil {
+	if _, err := url.Parse(rpcURL); err != nil {
 		return nil, fmt.Errorf("failed to create XML-RPC client: %w", err)
 	}
 
 	return &Client{
-		xmlrpc: client,
-		auth:   auth,
+		url:         rpcURL,
+		httpClient:  &http.Client{Transport: authTransport},
+		transport:   transport,
+		auth:        opts.Auth,
+		callTimeout: opts.CallTimeout,
+		waitTimeout: opts.WaitTimeout,
+		retry:       opts.Retry,
+		breaker:     newBreaker(opts.Breaker),
 	}, nil
 }
 
+// buildTLSConfig loads the CA bundle and client certificate of a server
+func buildTLSConfig(opts *TLSOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if opts.CAFile != "" {
+		caPEM, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
 // authRoundTripper implements http.RoundTripper
 type authRoundTripper struct {
 	base http.RoundTripper
@@ -65,56 +175,499 @@ func (t *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 }
 
 func (c *Client) Close() {
-	c.xmlrpc.Close()
+	c.transport.CloseIdleConnections()
+}
+
+// BreakerState returns the current state of the client's circuit breaker
+func (c *Client) BreakerState() BreakerState {
+	return c.breaker.currentState()
+}
+
+// call performs an XML-RPC call that changes state through the circuit
+// breaker, retrying it only when the connection could not be made. Faults
+// returned by supervisord come back as xmlrpc.FaultError.
+func (c *Client) call(ctx context.Context, method string, args []interface{}, result interface{}) error {
+	return c.callWithin(ctx, c.callTimeout, false, method, args, result)
+}
+
+// read is call for read-only methods, which are retried on any transient
+// failure
+func (c *Client) read(ctx context.Context, method string, args []interface{}, result interface{}) error {
+	return c.callWithin(ctx, c.callTimeout, true, method, args, result)
+}
+
+// callWaiting performs a call that only returns once processes finished
+// starting or stopping, which takes up to their startsecs or stopwaitsecs.
+// It gets the wait timeout instead of the call timeout.
+func (c *Client) callWaiting(ctx context.Context, method string, args []interface{}, result interface{}) error {
+	return c.callWithin(ctx, c.waitTimeout, false, method, args, result)
+}
+
+// callWithin performs a call with a limit of timeout per attempt. readOnly
+// marks calls that are safe to send again after any transient failure.
+func (c *Client) callWithin(ctx context.Context, timeout time.Duration, readOnly bool, method string, args []interface{}, result interface{}) error {
+	backoff := c.retry.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.allow() {
+			if err != nil {
+				// The breaker opened while retrying, report the real failure
+				return err
+			}
+			return fmt.Errorf("%w: %s", ErrBreakerOpen, method)
+		}
+
+		err = c.do(ctx, timeout, method, args, result)
+		if ctx.Err() != nil {
+			// The caller gave up, that says nothing about the server
+			c.breaker.release()
+			return err
+		}
+		failed := isTransient(err)
+		c.breaker.record(failed)
+
+		if !failed || attempt >= c.retry.Attempts || !retryable(readOnly, err) {
+			return err
+		}
+		log.Printf("Retrying %s on %s in %s after attempt %d failed: %v", method, c.url, backoff, attempt, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+		if c.retry.MaxBackoff > 0 && backoff > c.retry.MaxBackoff {
+			backoff = c.retry.MaxBackoff
+		}
+	}
+}
+
+// isTransient reports whether err means the server could not be reached or
+// failed to answer, as opposed to a fault or a rejected request
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var fault xmlrpc.FaultError
+	if errors.As(err, &fault) {
+		return false
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code >= 500
+	}
+	return true
+}
+
+// retryable reports whether a failed call is safe to send again. Read-only
+// calls always are, others only when the connection was never made.
+func retryable(readOnly bool, err error) bool {
+	if readOnly {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// statusError is a non-2xx HTTP response to an XML-RPC call
+type statusError struct {
+	method string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: request error: bad status code - %d", e.method, e.code)
+}
+
+// do performs one XML-RPC call, bounded by ctx and timeout
+func (c *Client) do(ctx context.Context, timeout time.Duration, method string, args []interface{}, result interface{}) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := xmlrpc.NewRequest(c.url, method, args)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s call: %w", method, err)
+	}
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return wrapCallError(ctx, method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &statusError{method: method, code: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return wrapCallError(ctx, method, err)
+	}
+
+	response := xmlrpc.Response(body)
+	if err := response.Err(); err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return response.Unmarshal(result)
+}
+
+// wrapCallError marks errors caused by a deadline with ErrTimeout
+func wrapCallError(ctx context.Context, method string, err error) error {
+	var netErr net.Error
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %s: %v", ErrTimeout, method, err)
+	}
+	return fmt.Errorf("%s: %w", method, err)
 }
 
-func (c *Client) GetAllProcesses() ([]models.Process, error) {
+func (c *Client) GetAllProcesses(ctx context.Context) ([]models.Process, error) {
 	var processesRaw []map[string]interface{}
-	err := c.xmlrpc.Call("supervisor.getAllProcessInfo", nil, &processesRaw)
+	err := c.read(ctx, "supervisor.getAllProcessInfo", nil, &processesRaw)
 	if err != nil {
 		return nil, err
 	}
 
 	processes := make([]models.Process, len(processesRaw))
 	for i, p := range processesRaw {
-		name, ok := p["name"].(string)
-		if !ok {
-			name = "Unknown"
-		}
+		processes[i] = parseProcess(p)
+	}
+	return processes, nil
+}
 
-		state, ok := p["statename"].(string)
-		if !ok {
-			state = "Unknown"
-		}
+// GetState returns supervisord's state name, e.g. RUNNING or SHUTDOWN
+func (c *Client) GetState(ctx context.Context) (string, error) {
+	var state map[string]interface{}
+	if err := c.read(ctx, "supervisor.getState", nil, &state); err != nil {
+		return "", err
+	}
+	name, _ := state["statename"].(string)
+	return name, nil
+}
 
-		description, ok := p["description"].(string)
-		if !ok {
-			description = "No description available"
-		}
+// GetPID returns the PID of supervisord itself
+func (c *Client) GetPID(ctx context.Context) (int, error) {
+	var pid int
+	err := c.read(ctx, "supervisor.getPID", nil, &pid)
+	return pid, err
+}
 
-		processes[i] = models.Process{
-			Name:        name,
-			State:       state,
-			Description: description,
-		}
+// GetSupervisorVersion returns the version of the running supervisord
+func (c *Client) GetSupervisorVersion(ctx context.Context) (string, error) {
+	var version string
+	err := c.read(ctx, "supervisor.getSupervisorVersion", nil, &version)
+	return version, err
+}
+
+// GetIdentification returns the identifier set in supervisord.conf
+func (c *Client) GetIdentification(ctx context.Context) (string, error) {
+	var identification string
+	err := c.read(ctx, "supervisor.getIdentification", nil, &identification)
+	return identification, err
+}
+
+// GetAllConfigInfo returns the configuration of every process, including
+// processes removed from the config files that are still running
+func (c *Client) GetAllConfigInfo(ctx context.Context) ([]models.ProcessConfig, error) {
+	var infos []map[string]interface{}
+	if err := c.read(ctx, "supervisor.getAllConfigInfo", nil, &infos); err != nil {
+		log.Printf("Error getting config info: %v", err)
+		return nil, err
+	}
+
+	configs := make([]models.ProcessConfig, 0, len(infos))
+	for _, info := range infos {
+		configs = append(configs, parseProcessConfig(info))
+	}
+	return configs, nil
+}
+
+// GetProcessInfo fetches a single process by name ("group:name" for grouped processes)
+func (c *Client) GetProcessInfo(ctx context.Context, processName string) (models.Process, error) {
+	var info map[string]interface{}
+	err := c.read(ctx, "supervisor.getProcessInfo", []interface{}{processName}, &info)
+	if err != nil {
+		return models.Process{}, err
+	}
+	return parseProcess(info), nil
+}
+
+// parseProcess converts a getProcessInfo struct into a Process
+func parseProcess(p map[string]interface{}) models.Process {
+	name, ok := p["name"].(string)
+	if !ok {
+		name = "Unknown"
+	}
+
+	state, ok := p["statename"].(string)
+	if !ok {
+		state = "Unknown"
+	}
+
+	description, ok := p["description"].(string)
+	if !ok {
+		description = "No description available"
+	}
+
+	group, _ := p["group"].(string)
+	spawnErr, _ := p["spawnerr"].(string)
+	stdoutLogfile, _ := p["stdout_logfile"].(string)
+	stderrLogfile, _ := p["stderr_logfile"].(string)
+	pid, _ := p["pid"].(int64)
+	exitStatus, _ := p["exitstatus"].(int64)
+
+	return models.Process{
+		Name:          name,
+		State:         state,
+		Description:   description,
+		Group:         group,
+		Pid:           int(pid),
+		Start:         unixTime(p["start"]),
+		Stop:          unixTime(p["stop"]),
+		Now:           unixTime(p["now"]),
+		ExitStatus:    int(exitStatus),
+		SpawnErr:      spawnErr,
+		StdoutLogfile: stdoutLogfile,
+		StderrLogfile: stderrLogfile,
 	}
-	return processes, nil
 }
 
-func (c *Client) StartProcess(processName string) error {
+// unixTime converts a supervisor timestamp, where 0 means "never", to a time
+func unixTime(v interface{}) time.Time {
+	sec, ok := v.(int64)
+	if !ok || sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+func (c *Client) StartProcess(ctx context.Context, processName string) error {
 	var result bool
-	err := c.xmlrpc.Call("supervisor.startProcess", []interface{}{processName}, &result)
+	err := c.callWaiting(ctx, "supervisor.startProcess", []interface{}{processName, true}, &result)
 	if err != nil {
 		log.Printf("Error starting process %s: %v", processName, err)
 	}
 	return err
 }
 
-func (c *Client) StopProcess(processName string) error {
+func (c *Client) StopProcess(ctx context.Context, processName string) error {
 	var result bool
-	err := c.xmlrpc.Call("supervisor.stopProcess", []interface{}{processName}, &result)
+	err := c.callWaiting(ctx, "supervisor.stopProcess", []interface{}{processName, true}, &result)
 	if err != nil {
 		log.Printf("Error stopping process %s: %v", processName, err)
 	}
 	return err
 }
+
+// RestartProcess stops the process (waiting for it to exit) and starts it again
+func (c *Client) RestartProcess(ctx context.Context, processName string) error {
+	var result bool
+	err := c.callWaiting(ctx, "supervisor.stopProcess", []interface{}{processName, true}, &result)
+	if err != nil && !IsFault(err, FaultNotRunning) {
+		log.Printf("Error stopping process %s for restart: %v", processName, err)
+		return err
+	}
+
+	err = c.callWaiting(ctx, "supervisor.startProcess", []interface{}{processName, true}, &result)
+	if err != nil {
+		log.Printf("Error starting process %s for restart: %v", processName, err)
+	}
+	return err
+}
+
+// SignalProcess sends a signal (e.g. "HUP" or "USR1") to the process
+func (c *Client) SignalProcess(ctx context.Context, processName, signal string) error {
+	var result bool
+	err := c.call(ctx, "supervisor.signalProcess", []interface{}{processName, signal}, &result)
+	if err != nil {
+		log.Printf("Error sending %s to process %s: %v", signal, processName, err)
+	}
+	return err
+}
+
+// SendProcessStdin writes chars to the stdin of a running process. Nothing is
+// appended, callers add a newline when the process reads lines.
+func (c *Client) SendProcessStdin(ctx context.Context, processName, chars string) error {
+	var result bool
+	err := c.call(ctx, "supervisor.sendProcessStdin", []interface{}{processName, chars}, &result)
+	if err != nil {
+		log.Printf("Error sending stdin to process %s: %v", processName, err)
+	}
+	return err
+}
+
+func (c *Client) StartProcessGroup(ctx context.Context, groupName string) error {
+	return c.callMulti(ctx, c.waitTimeout, "supervisor.startProcessGroup", groupName, true)
+}
+
+func (c *Client) StopProcessGroup(ctx context.Context, groupName string) error {
+	return c.callMulti(ctx, c.waitTimeout, "supervisor.stopProcessGroup", groupName, true)
+}
+
+func (c *Client) StartAllProcesses(ctx context.Context) error {
+	return c.callMulti(ctx, c.waitTimeout, "supervisor.startAllProcesses", true)
+}
+
+func (c *Client) StopAllProcesses(ctx context.Context) error {
+	return c.callMulti(ctx, c.waitTimeout, "supervisor.stopAllProcesses", true)
+}
+
+func (c *Client) SignalAllProcesses(ctx context.Context, signal string) error {
+	return c.callMulti(ctx, c.callTimeout, "supervisor.signalAllProcesses", signal)
+}
+
+// callMulti invokes a method that returns one status struct per affected process
+// and turns any non-successful entry into an error
+func (c *Client) callMulti(ctx context.Context, timeout time.Duration, method string, args ...interface{}) error {
+	var results []map[string]interface{}
+	err := c.callWithin(ctx, timeout, false, method, args, &results)
+	if err != nil {
+		log.Printf("Error calling %s: %v", method, err)
+		return err
+	}
+
+	var failures []string
+	for _, r := range results {
+		status, _ := r["status"].(int64)
+		// Group calls report SUCCESS per process on top of the fault codes
+		if status == FaultSuccess {
+			continue
+		}
+		name, _ := r["name"].(string)
+		group, _ := r["group"].(string)
+		description, _ := r["description"].(string)
+		failures = append(failures, fmt.Sprintf("%s:%s: %s", group, name, description))
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s failed for %d process(es): %s", method, len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// LogTail is the result of tailing a process log
+type LogTail struct {
+	Data     string
+	Offset   int64 // log size, i.e. where the next tail should start
+	Overflow bool  // more data was written than requested
+}
+
+func (c *Client) TailProcessStdoutLog(ctx context.Context, processName string, offset, length int64) (LogTail, error) {
+	return c.tailLog(ctx, "supervisor.tailProcessStdoutLog", processName, offset, length)
+}
+
+func (c *Client) TailProcessStderrLog(ctx context.Context, processName string, offset, length int64) (LogTail, error) {
+	return c.tailLog(ctx, "supervisor.tailProcessStderrLog", processName, offset, length)
+}
+
+func (c *Client) ReadProcessStdoutLog(ctx context.Context, processName string, offset, length int64) (string, error) {
+	return c.readLog(ctx, "supervisor.readProcessStdoutLog", processName, offset, length)
+}
+
+func (c *Client) ReadProcessStderrLog(ctx context.Context, processName string, offset, length int64) (string, error) {
+	return c.readLog(ctx, "supervisor.readProcessStderrLog", processName, offset, length)
+}
+
+// ReadLog reads the supervisord main log. A negative offset with zero length
+// returns that many bytes from the end of the log.
+func (c *Client) ReadLog(ctx context.Context, offset, length int64) (string, error) {
+	var data string
+	err := c.read(ctx, "supervisor.readLog", []interface{}{offset, length}, &data)
+	if err != nil {
+		log.Printf("Error reading supervisord log: %v", err)
+	}
+	return data, err
+}
+
+// logSizeProbes is the number of single-byte reads in one LogSize round.
+// The first round probes offsets up to 2^47, far beyond any real log.
+const logSizeProbes = 48
+
+// LogSize returns the size of the supervisord main log, which readLog can
+// then read at absolute offsets. supervisord has no call for it, so it is
+// found by reading single bytes, first at growing offsets and then between
+// the last byte found and the first one missing, each round in one multicall.
+func (c *Client) LogSize(ctx context.Context) (int64, error) {
+	offsets := make([]int64, logSizeProbes)
+	for i := range offsets {
+		offsets[i] = 1<<i - 1
+	}
+
+	// lo is the last offset known to hold a byte and hi the first known not
+	// to, the size is hi once they are adjacent
+	lo, hi := int64(-1), int64(-1)
+	for {
+		calls := make([]Call, len(offsets))
+		for i, offset := range offsets {
+			calls[i] = Call{Method: "supervisor.readLog", Params: []interface{}{offset, 1}}
+		}
+		results, err := c.multicall(ctx, calls, true)
+		if err != nil {
+			log.Printf("Error finding the supervisord log size: %v", err)
+			return 0, err
+		}
+		for i, result := range results {
+			if result.Err != nil {
+				return 0, result.Err
+			}
+			if data, _ := result.Value.(string); data == "" {
+				hi = offsets[i]
+				break
+			}
+			lo = offsets[i]
+		}
+		if hi < 0 {
+			return 0, fmt.Errorf("supervisord log is larger than %d bytes", lo+1)
+		}
+		if hi-lo == 1 {
+			return hi, nil
+		}
+
+		step := (hi - lo + logSizeProbes - 1) / logSizeProbes
+		offsets = offsets[:0]
+		for offset := lo + step; offset < hi; offset += step {
+			offsets = append(offsets, offset)
+		}
+	}
+}
+
+// ClearLog truncates the supervisord main log
+func (c *Client) ClearLog(ctx context.Context) error {
+	var result bool
+	err := c.call(ctx, "supervisor.clearLog", nil, &result)
+	if err != nil {
+		log.Printf("Error clearing supervisord log: %v", err)
+	}
+	return err
+}
+
+func (c *Client) tailLog(ctx context.Context, method, processName string, offset, length int64) (LogTail, error) {
+	var result []interface{}
+	err := c.read(ctx, method, []interface{}{processName, offset, length}, &result)
+	if err != nil {
+		log.Printf("Error tailing log of process %s: %v", processName, err)
+		return LogTail{}, err
+	}
+	if len(result) != 3 {
+		return LogTail{}, fmt.Errorf("unexpected %s response: %v", method, result)
+	}
+
+	var tail LogTail
+	tail.Data, _ = result[0].(string)
+	tail.Offset, _ = result[1].(int64)
+	tail.Overflow, _ = result[2].(bool)
+	return tail, nil
+}
+
+func (c *Client) readLog(ctx context.Context, method, processName string, offset, length int64) (string, error) {
+	var data string
+	err := c.read(ctx, method, []interface{}{processName, offset, length}, &data)
+	if err != nil {
+		log.Printf("Error reading log of process %s: %v", processName, err)
+	}
+	return data, err
+}
@@ -0,0 +1,135 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer answers every request with 503 and counts them
+func failingServer(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &requests
+}
+
+func TestRetries(t *testing.T) {
+	retry := RetryOptions{Attempts: 3, InitialBackoff: time.Millisecond}
+	tests := []struct {
+		name string
+		call func(*Client) error
+		want int32
+	}{
+		{name: "read-only call", want: 3, call: func(c *Client) error {
+			_, err := c.GetAllProcesses(context.Background())
+			return err
+		}},
+		{name: "status multicall", want: 3, call: func(c *Client) error {
+			_, err := c.GetSnapshot(context.Background(), false)
+			return err
+		}},
+		{name: "stop", want: 1, call: func(c *Client) error {
+			return c.StopProcess(context.Background(), "web")
+		}},
+		{name: "group start", want: 1, call: func(c *Client) error {
+			return c.StartProcessGroup(context.Background(), "web")
+		}},
+	}
+	for _, tt := range tests {
+		url, requests := failingServer(t)
+		client, err := NewClient(url, Options{Retry: retry})
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		if err := tt.call(client); err == nil {
+			t.Errorf("%s: no error from a failing server", tt.name)
+		}
+		if got := requests.Load(); got != tt.want {
+			t.Errorf("%s: sent %d requests, want %d", tt.name, got, tt.want)
+		}
+		client.Close()
+	}
+}
+
+func TestRetryOnRefusedConnection(t *testing.T) {
+	// Nothing listens there once the server is closed
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	client, err := NewClient(url, Options{
+		Retry:   RetryOptions{Attempts: 2, InitialBackoff: time.Millisecond},
+		Breaker: BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	if err := client.StopProcess(context.Background(), "web"); err == nil {
+		t.Fatal("no error from a closed server")
+	}
+	// Both attempts failed, which takes the breaker to its threshold
+	if client.BreakerState() != BreakerOpen {
+		t.Errorf("breaker %s, want open after a retried stop", client.BreakerState())
+	}
+}
+
+func TestBreakerStopsCalls(t *testing.T) {
+	url, requests := failingServer(t)
+	client, err := NewClient(url, Options{Breaker: BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Minute}})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetState(context.Background()); err == nil || errors.Is(err, ErrBreakerOpen) {
+			t.Fatalf("call %d: error = %v, want the server's", i, err)
+		}
+	}
+	if _, err := client.GetState(context.Background()); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("error = %v, want ErrBreakerOpen", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+	if client.BreakerState() != BreakerOpen {
+		t.Errorf("breaker %s, want open", client.BreakerState())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	hung := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hung
+	}))
+	defer srv.Close()
+	defer close(hung)
+
+	client, err := NewClient(srv.URL, Options{CallTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.GetPID(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Errorf("error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestParseProcessConfigAutorestart(t *testing.T) {
+	// supervisor 4 reports autorestart as a string, older versions as a boolean
+	for value, want := range map[interface{}]string{"unexpected": "unexpected", "false": "false", true: "true", false: "false"} {
+		if got := parseProcessConfig(map[string]interface{}{"autorestart": value}).Autorestart; got != want {
+			t.Errorf("autorestart %#v = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package supervisor
+
+import (
+	"errors"
+
+	"github.com/kolo/xmlrpc"
+)
+
+// Fault codes used by supervisord's XML-RPC interface
+const (
+	FaultUnknownMethod        = 1
+	FaultIncorrectParameters  = 2
+	FaultBadArguments         = 3
+	FaultSignatureUnsupported = 4
+	FaultShutdownState        = 6
+	FaultBadName              = 10
+	FaultBadSignal            = 11
+	FaultNoFile               = 20
+	FaultNotExecutable        = 21
+	FaultFailed               = 30
+	FaultAbnormalTermination  = 40
+	FaultSpawnError           = 50
+	FaultAlreadyStarted       = 60
+	FaultNotRunning           = 70
+	FaultSuccess              = 80
+	FaultAlreadyAdded         = 90
+	FaultStillRunning         = 91
+	FaultCantReread           = 92
+)
+
+// IsFault reports whether err is a supervisor fault with the given code
+func IsFault(err error, code int) bool {
+	var fault xmlrpc.FaultError
+	return errors.As(err, &fault) && fault.Code == code
+}
+
+var faultNames = map[int]string{
+	FaultUnknownMethod:        "UNKNOWN_METHOD",
+	FaultIncorrectParameters:  "INCORRECT_PARAMETERS",
+	FaultBadArguments:         "BAD_ARGUMENTS",
+	FaultSignatureUnsupported: "SIGNATURE_UNSUPPORTED",
+	FaultShutdownState:        "SHUTDOWN_STATE",
+	FaultBadName:              "BAD_NAME",
+	FaultBadSignal:            "BAD_SIGNAL",
+	FaultNoFile:               "NO_FILE",
+	FaultNotExecutable:        "NOT_EXECUTABLE",
+	FaultFailed:               "FAILED",
+	FaultAbnormalTermination:  "ABNORMAL_TERMINATION",
+	FaultSpawnError:           "SPAWN_ERROR",
+	FaultAlreadyStarted:       "ALREADY_STARTED",
+	FaultNotRunning:           "NOT_RUNNING",
+	FaultSuccess:              "SUCCESS",
+	FaultAlreadyAdded:         "ALREADY_ADDED",
+	FaultStillRunning:         "STILL_RUNNING",
+	FaultCantReread:           "CANT_REREAD",
+}
+
+// AsFault returns the fault code and its supervisord name when err is a
+// supervisor fault
+func AsFault(err error) (int, string, bool) {
+	var fault xmlrpc.FaultError
+	if !errors.As(err, &fault) {
+		return 0, "", false
+	}
+	name, ok := faultNames[fault.Code]
+	if !ok {
+		name = "UNKNOWN"
+	}
+	return fault.Code, name, true
+}
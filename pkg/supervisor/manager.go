@@ -0,0 +1,52 @@
+package supervisor
+
+import (
+	"context"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+)
+
+// ProcessManager is everything the bot needs from a supervisord server.
+// Client implements it; tests can substitute their own implementation.
+type ProcessManager interface {
+	Close()
+	BreakerState() BreakerState
+
+	GetState(ctx context.Context) (string, error)
+	GetPID(ctx context.Context) (int, error)
+	GetSupervisorVersion(ctx context.Context) (string, error)
+	GetIdentification(ctx context.Context) (string, error)
+
+	GetAllProcesses(ctx context.Context) ([]models.Process, error)
+	GetProcessInfo(ctx context.Context, processName string) (models.Process, error)
+	GetAllConfigInfo(ctx context.Context) ([]models.ProcessConfig, error)
+	GetSnapshot(ctx context.Context, withConfig bool) (Snapshot, error)
+	Multicall(ctx context.Context, calls []Call) ([]CallResult, error)
+
+	StartProcess(ctx context.Context, processName string) error
+	StopProcess(ctx context.Context, processName string) error
+	RestartProcess(ctx context.Context, processName string) error
+	SignalProcess(ctx context.Context, processName, signal string) error
+	SendProcessStdin(ctx context.Context, processName, chars string) error
+
+	StartProcessGroup(ctx context.Context, groupName string) error
+	StopProcessGroup(ctx context.Context, groupName string) error
+	StartAllProcesses(ctx context.Context) error
+	StopAllProcesses(ctx context.Context) error
+	SignalAllProcesses(ctx context.Context, signal string) error
+
+	ReloadConfig(ctx context.Context) (ConfigChanges, error)
+	AddProcessGroup(ctx context.Context, groupName string) error
+	RemoveProcessGroup(ctx context.Context, groupName string) error
+	UpdateConfig(ctx context.Context, changes ConfigChanges) error
+
+	TailProcessStdoutLog(ctx context.Context, processName string, offset, length int64) (LogTail, error)
+	TailProcessStderrLog(ctx context.Context, processName string, offset, length int64) (LogTail, error)
+	ReadProcessStdoutLog(ctx context.Context, processName string, offset, length int64) (string, error)
+	ReadProcessStderrLog(ctx context.Context, processName string, offset, length int64) (string, error)
+	ReadLog(ctx context.Context, offset, length int64) (string, error)
+	LogSize(ctx context.Context) (int64, error)
+	ClearLog(ctx context.Context) error
+}
+
+var _ ProcessManager = (*Client)(nil)
@@ -0,0 +1,170 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kolo/xmlrpc"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+)
+
+// Call is one method call of a system.multicall batch
+type Call struct {
+	Method string
+	Params []interface{}
+}
+
+// CallResult is the outcome of one call of a batch. Err holds the
+// xmlrpc.FaultError when that call failed.
+type CallResult struct {
+	Value interface{}
+	Err   error
+}
+
+// Multicall runs several calls in one round trip. The returned error is only
+// set when the batch as a whole failed; per-call faults are in the results.
+// The batch may change state, so it is only retried when the connection
+// could not be made.
+func (c *Client) Multicall(ctx context.Context, calls []Call) ([]CallResult, error) {
+	return c.multicall(ctx, calls, false)
+}
+
+// multicall is Multicall, retried on any transient failure when readOnly
+// tells that every call of the batch is read-only
+func (c *Client) multicall(ctx context.Context, calls []Call, readOnly bool) ([]CallResult, error) {
+	batch := make([]interface{}, len(calls))
+	for i, call := range calls {
+		params := call.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		batch[i] = map[string]interface{}{
+			"methodName": call.Method,
+			"params":     params,
+		}
+	}
+
+	var raw []interface{}
+	if err := c.callWithin(ctx, c.callTimeout, readOnly, "system.multicall", []interface{}{batch}, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) != len(calls) {
+		return nil, fmt.Errorf("system.multicall returned %d results for %d calls", len(raw), len(calls))
+	}
+
+	results := make([]CallResult, len(raw))
+	for i, entry := range raw {
+		switch v := entry.(type) {
+		case []interface{}:
+			// Successful calls are wrapped in a one element array
+			if len(v) == 1 {
+				results[i].Value = v[0]
+			}
+		case map[string]interface{}:
+			code, _ := v["faultCode"].(int64)
+			message, _ := v["faultString"].(string)
+			results[i].Err = xmlrpc.FaultError{Code: int(code), String: message}
+		default:
+			results[i].Err = fmt.Errorf("unexpected result of %s: %v", calls[i].Method, entry)
+		}
+	}
+	return results, nil
+}
+
+// Snapshot is the state of a server fetched in a single round trip
+type Snapshot struct {
+	State          string // supervisord state, e.g. RUNNING or SHUTDOWN
+	PID            int    // supervisord's own PID
+	Version        string
+	Identification string
+	Processes      []models.Process
+	Configs        []models.ProcessConfig // only filled when requested
+}
+
+// GetSnapshot fetches supervisord's state, PID, version and identification
+// and all process info, plus the process configuration when withConfig is
+// set, with one system.multicall
+func (c *Client) GetSnapshot(ctx context.Context, withConfig bool) (Snapshot, error) {
+	calls := []Call{
+		{Method: "supervisor.getState"},
+		{Method: "supervisor.getPID"},
+		{Method: "supervisor.getSupervisorVersion"},
+		{Method: "supervisor.getIdentification"},
+		{Method: "supervisor.getAllProcessInfo"},
+	}
+	if withConfig {
+		calls = append(calls, Call{Method: "supervisor.getAllConfigInfo"})
+	}
+
+	results, err := c.multicall(ctx, calls, true)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			return Snapshot{}, fmt.Errorf("%s: %w", calls[i].Method, result.Err)
+		}
+	}
+
+	var snapshot Snapshot
+	if state, ok := results[0].Value.(map[string]interface{}); ok {
+		snapshot.State, _ = state["statename"].(string)
+	}
+	pid, _ := results[1].Value.(int64)
+	snapshot.PID = int(pid)
+	snapshot.Version, _ = results[2].Value.(string)
+	snapshot.Identification, _ = results[3].Value.(string)
+	for _, info := range structList(results[4].Value) {
+		snapshot.Processes = append(snapshot.Processes, parseProcess(info))
+	}
+	if withConfig {
+		for _, info := range structList(results[5].Value) {
+			snapshot.Configs = append(snapshot.Configs, parseProcessConfig(info))
+		}
+	}
+	return snapshot, nil
+}
+
+// structList converts a decoded array of structs
+func structList(value interface{}) []map[string]interface{} {
+	items, _ := value.([]interface{})
+	list := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+// parseProcessConfig converts a getAllConfigInfo struct into a ProcessConfig
+func parseProcessConfig(p map[string]interface{}) models.ProcessConfig {
+	var config models.ProcessConfig
+	config.Name, _ = p["name"].(string)
+	config.Group, _ = p["group"].(string)
+	config.Command, _ = p["command"].(string)
+	config.Directory, _ = p["directory"].(string)
+	config.Autostart, _ = p["autostart"].(bool)
+	config.StopSignal, _ = p["stopsignal"].(string)
+	config.StdoutLogfile, _ = p["stdout_logfile"].(string)
+	config.StderrLogfile, _ = p["stderr_logfile"].(string)
+	config.InUse, _ = p["inuse"].(bool)
+
+	// autorestart is a string in supervisor 4, a boolean in older versions
+	switch v := p["autorestart"].(type) {
+	case string:
+		config.Autorestart = v
+	case bool:
+		config.Autorestart = fmt.Sprint(v)
+	}
+
+	startSecs, _ := p["startsecs"].(int64)
+	startRetries, _ := p["startretries"].(int64)
+	stopWaitSecs, _ := p["stopwaitsecs"].(int64)
+	priority, _ := p["process_prio"].(int64)
+	config.StartSecs = int(startSecs)
+	config.StartRetries = int(startRetries)
+	config.StopWaitSecs = int(stopWaitSecs)
+	config.Priority = int(priority)
+	return config
+}
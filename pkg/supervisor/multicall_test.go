@@ -0,0 +1,130 @@
+package supervisor_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+)
+
+func TestGetSnapshot(t *testing.T) {
+	server := supervisortest.NewServer()
+	defer server.Close()
+	server.AddProcess(supervisortest.Process{Name: "web", State: "RUNNING", Pid: 1234, Command: "/usr/bin/web"})
+	server.AddProcess(supervisortest.Process{Name: "worker", Group: "jobs", State: "FATAL"})
+	server.SetDaemonState("RESTARTING")
+	client := newTestClient(t, server, supervisor.Options{})
+
+	snapshot, err := client.GetSnapshot(context.Background(), false)
+	if err != nil {
+		t.Fatalf("GetSnapshot: %v", err)
+	}
+	if snapshot.State != "RESTARTING" || snapshot.PID != 1 || snapshot.Version != "4.2.5" || snapshot.Identification != "supervisor" {
+		t.Errorf("daemon fields = %q, %d, %q, %q", snapshot.State, snapshot.PID, snapshot.Version, snapshot.Identification)
+	}
+	if len(snapshot.Processes) != 2 {
+		t.Fatalf("processes = %+v, want 2", snapshot.Processes)
+	}
+	if web := snapshot.Processes[1]; web.Name != "web" || web.State != "RUNNING" || web.Pid != 1234 {
+		t.Errorf("web = %+v", web)
+	}
+	if worker := snapshot.Processes[0]; worker.FullName() != "jobs:worker" || worker.State != "FATAL" {
+		t.Errorf("worker = %+v", worker)
+	}
+	if snapshot.Configs != nil {
+		t.Errorf("configs = %+v without asking for them", snapshot.Configs)
+	}
+	if calls := server.Calls(); len(calls) != 6 || calls[0] != "system.multicall" {
+		t.Errorf("calls = %v, want one system.multicall of 5 calls", calls)
+	}
+
+	snapshot, err = client.GetSnapshot(context.Background(), true)
+	if err != nil {
+		t.Fatalf("GetSnapshot with config: %v", err)
+	}
+	if len(snapshot.Configs) != 2 || snapshot.Configs[1].Name != "web" || snapshot.Configs[1].Command != "/usr/bin/web" {
+		t.Errorf("configs = %+v", snapshot.Configs)
+	}
+}
+
+func TestGetSnapshotFaults(t *testing.T) {
+	server := supervisortest.NewServer()
+	defer server.Close()
+	client := newTestClient(t, server, supervisor.Options{})
+
+	server.FailMethod("supervisor.getAllConfigInfo", supervisor.FaultFailed, "FAILED")
+	if _, err := client.GetSnapshot(context.Background(), false); err != nil {
+		t.Errorf("GetSnapshot without config = %v, the failing call isn't in the batch", err)
+	}
+	// One failed call fails the whole snapshot, naming the call
+	_, err := client.GetSnapshot(context.Background(), true)
+	if !supervisor.IsFault(err, supervisor.FaultFailed) || !strings.Contains(err.Error(), "supervisor.getAllConfigInfo") {
+		t.Errorf("GetSnapshot = %v, want the getAllConfigInfo fault", err)
+	}
+
+	server.FailMethod("system.multicall", supervisor.FaultUnknownMethod, "UNKNOWN_METHOD")
+	if _, err := client.GetSnapshot(context.Background(), false); !supervisor.IsFault(err, supervisor.FaultUnknownMethod) {
+		t.Errorf("GetSnapshot = %v, want the multicall fault", err)
+	}
+}
+
+func TestMulticall(t *testing.T) {
+	server := supervisortest.NewServer()
+	defer server.Close()
+	server.AddProcess(supervisortest.Process{Name: "web", State: "STOPPED"})
+	client := newTestClient(t, server, supervisor.Options{})
+
+	results, err := client.Multicall(context.Background(), []supervisor.Call{
+		{Method: "supervisor.startProcess", Params: []interface{}{"web"}},
+		{Method: "supervisor.startProcess", Params: []interface{}{"missing"}},
+		{Method: "supervisor.getPID"},
+	})
+	if err != nil {
+		t.Fatalf("Multicall: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("results = %+v, want 3", results)
+	}
+	if results[0].Err != nil || results[0].Value != true || server.State("web") != "RUNNING" {
+		t.Errorf("start web = %+v, web %s", results[0], server.State("web"))
+	}
+	if !supervisor.IsFault(results[1].Err, supervisor.FaultBadName) {
+		t.Errorf("start missing = %+v, want BAD_NAME", results[1])
+	}
+	if results[2].Err != nil || results[2].Value != int64(1) {
+		t.Errorf("getPID = %+v, the batch must go on after a fault", results[2])
+	}
+}
+
+func TestLogSize(t *testing.T) {
+	server := supervisortest.NewServer()
+	defer server.Close()
+	client := newTestClient(t, server, supervisor.Options{})
+
+	size := 0
+	for _, grow := range []int{0, 1, 1, 1, 61, 936, 99000, 1 << 20} {
+		server.AppendDaemonLog(strings.Repeat("x", grow))
+		size += grow
+
+		before := len(server.Calls())
+		got, err := client.LogSize(context.Background())
+		if err != nil {
+			t.Fatalf("LogSize of %d bytes: %v", size, err)
+		}
+		if got != int64(size) {
+			t.Errorf("LogSize = %d, want %d", got, size)
+		}
+		// Every round is one multicall of single-byte reads
+		rounds := 0
+		for _, call := range server.Calls()[before:] {
+			if call == "system.multicall" {
+				rounds++
+			}
+		}
+		if rounds > 5 {
+			t.Errorf("LogSize of %d bytes took %d round trips", size, rounds)
+		}
+	}
+}
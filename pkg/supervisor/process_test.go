@@ -0,0 +1,93 @@
+package supervisor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+)
+
+func TestProcessRunInfo(t *testing.T) {
+	server := supervisortest.NewServer()
+	defer server.Close()
+	started := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	stopped := started.Add(90 * time.Minute)
+	server.AddProcess(supervisortest.Process{Name: "web", Group: "web", State: "RUNNING", Pid: 42, Start: started})
+	server.AddProcess(supervisortest.Process{Name: "worker", State: "EXITED", Start: started, Stop: stopped, ExitStatus: 2})
+	server.AddProcess(supervisortest.Process{Name: "cron", State: "FATAL", SpawnErr: "can't find command '/usr/bin/cron'"})
+	client := newTestClient(t, server, supervisor.Options{})
+
+	web, err := client.GetProcessInfo(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("GetProcessInfo: %v", err)
+	}
+	if web.Pid != 42 || !web.Start.Equal(started) || !web.Stop.IsZero() {
+		t.Errorf("web = pid %d, start %v, stop %v", web.Pid, web.Start, web.Stop)
+	}
+	// Uptime is measured against supervisord's clock
+	if uptime := web.Uptime(); uptime < 2*time.Hour || uptime > 2*time.Hour+time.Minute {
+		t.Errorf("web uptime = %v, want about 2h", uptime)
+	}
+
+	worker, err := client.GetProcessInfo(context.Background(), "worker")
+	if err != nil {
+		t.Fatalf("GetProcessInfo: %v", err)
+	}
+	if worker.ExitStatus != 2 || !worker.Stop.Equal(stopped) || worker.Uptime() != 90*time.Minute {
+		t.Errorf("worker = exit %d, stop %v, uptime %v, want 2, %v, 1h30m", worker.ExitStatus, worker.Stop, worker.Uptime(), stopped)
+	}
+
+	cron, err := client.GetProcessInfo(context.Background(), "cron")
+	if err != nil {
+		t.Fatalf("GetProcessInfo: %v", err)
+	}
+	if cron.SpawnErr != "can't find command '/usr/bin/cron'" || !cron.Start.IsZero() || cron.Uptime() != 0 {
+		t.Errorf("cron = spawn error %q, start %v, uptime %v", cron.SpawnErr, cron.Start, cron.Uptime())
+	}
+}
+
+func TestGetAllConfigInfo(t *testing.T) {
+	server := supervisortest.NewServer()
+	defer server.Close()
+	server.AddProcess(supervisortest.Process{Name: "web", Command: "/usr/bin/web --port=80"})
+	server.AddProcess(supervisortest.Process{Name: "worker_0", Group: "worker"})
+	client := newTestClient(t, server, supervisor.Options{})
+
+	configs, err := client.GetAllConfigInfo(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllConfigInfo: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("configs = %+v, want 2", configs)
+	}
+	want := models.ProcessConfig{
+		Name:          "web",
+		Group:         "web",
+		Command:       "/usr/bin/web --port=80",
+		Directory:     "none",
+		Autostart:     true,
+		Autorestart:   "unexpected",
+		StartSecs:     1,
+		StartRetries:  3,
+		StopSignal:    "TERM",
+		StopWaitSecs:  10,
+		Priority:      999,
+		StdoutLogfile: "/var/log/web.log",
+		StderrLogfile: "/var/log/web.err.log",
+		InUse:         true,
+	}
+	if configs[0] != want {
+		t.Errorf("web config = %+v, want %+v", configs[0], want)
+	}
+	if worker := configs[1]; worker.FullName() != "worker:worker_0" {
+		t.Errorf("worker config name = %q, want worker:worker_0", worker.FullName())
+	}
+
+	server.FailMethod("supervisor.getAllConfigInfo", supervisor.FaultFailed, "FAILED")
+	if _, err := client.GetAllConfigInfo(context.Background()); !supervisor.IsFault(err, supervisor.FaultFailed) {
+		t.Errorf("GetAllConfigInfo = %v, want the fault", err)
+	}
+}
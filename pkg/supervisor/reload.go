@@ -0,0 +1,95 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ConfigChanges are the process groups reloadConfig found changed on disk
+type ConfigChanges struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// Empty reports whether the config on disk matches the running config
+func (c ConfigChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Changed) == 0 && len(c.Removed) == 0
+}
+
+// ReloadConfig rereads the configuration files, like `supervisorctl reread`.
+// Nothing is applied until the groups are added or removed.
+func (c *Client) ReloadConfig(ctx context.Context) (ConfigChanges, error) {
+	var result [][][]string
+	if err := c.call(ctx, "supervisor.reloadConfig", nil, &result); err != nil {
+		log.Printf("Error reloading config: %v", err)
+		return ConfigChanges{}, err
+	}
+	if len(result) != 1 || len(result[0]) != 3 {
+		return ConfigChanges{}, fmt.Errorf("unexpected reloadConfig result: %v", result)
+	}
+	return ConfigChanges{
+		Added:   result[0][0],
+		Changed: result[0][1],
+		Removed: result[0][2],
+	}, nil
+}
+
+func (c *Client) AddProcessGroup(ctx context.Context, groupName string) error {
+	var result bool
+	return c.call(ctx, "supervisor.addProcessGroup", []interface{}{groupName}, &result)
+}
+
+// RemoveProcessGroup unloads a group. It fails with FaultStillRunning unless
+// all of its processes are stopped.
+func (c *Client) RemoveProcessGroup(ctx context.Context, groupName string) error {
+	var result bool
+	return c.call(ctx, "supervisor.removeProcessGroup", []interface{}{groupName}, &result)
+}
+
+// UpdateConfig applies reread changes the way `supervisorctl update` does:
+// removed groups are stopped and unloaded, changed groups are stopped and
+// loaded again, and added groups are loaded. It keeps going after a failed
+// group and returns all failures together.
+func (c *Client) UpdateConfig(ctx context.Context, changes ConfigChanges) error {
+	var failures []string
+
+	for _, group := range changes.Removed {
+		if err := c.unloadGroup(ctx, group); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", group, err))
+		}
+	}
+	for _, group := range changes.Changed {
+		if err := c.unloadGroup(ctx, group); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", group, err))
+			continue
+		}
+		if err := c.AddProcessGroup(ctx, group); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", group, err))
+		}
+	}
+	for _, group := range changes.Added {
+		if err := c.AddProcessGroup(ctx, group); err != nil && !IsFault(err, FaultAlreadyAdded) {
+			failures = append(failures, fmt.Sprintf("%s: %v", group, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("update failed for %d group(s): %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// unloadGroup stops a group and removes it. A group that is already gone is
+// not an error.
+func (c *Client) unloadGroup(ctx context.Context, group string) error {
+	if err := c.StopProcessGroup(ctx, group); err != nil && !IsFault(err, FaultBadName) {
+		return err
+	}
+	if err := c.RemoveProcessGroup(ctx, group); err != nil && !IsFault(err, FaultBadName) {
+		return err
+	}
+	return nil
+}
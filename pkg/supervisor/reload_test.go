@@ -0,0 +1,115 @@
+package supervisor_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+)
+
+// newTestClient connects to a fake supervisord
+func newTestClient(t *testing.T, server *supervisortest.Server, opts supervisor.Options) *supervisor.Client {
+	t.Helper()
+	client, err := supervisor.NewClient(server.URL, opts)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// newReloadServer has groups web (unchanged), worker (changed command) and
+// old (removed) running, and cron added on disk
+func newReloadServer(t *testing.T) *supervisortest.Server {
+	t.Helper()
+	server := supervisortest.NewServer()
+	t.Cleanup(server.Close)
+	server.AddProcess(supervisortest.Process{Name: "web", State: "RUNNING"})
+	server.AddProcess(supervisortest.Process{Name: "worker", State: "RUNNING"})
+	server.AddProcess(supervisortest.Process{Name: "old", State: "RUNNING"})
+	server.SetConfig(
+		supervisortest.Process{Name: "web"},
+		supervisortest.Process{Name: "worker", Command: "/usr/bin/worker --queue=high"},
+		supervisortest.Process{Name: "cron"},
+	)
+	return server
+}
+
+func TestReloadConfig(t *testing.T) {
+	server := newReloadServer(t)
+	client := newTestClient(t, server, supervisor.Options{})
+
+	changes, err := client.ReloadConfig(context.Background())
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	want := supervisor.ConfigChanges{Added: []string{"cron"}, Changed: []string{"worker"}, Removed: []string{"old"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("ReloadConfig = %+v, want %+v", changes, want)
+	}
+	if changes.Empty() {
+		t.Error("changes reported as empty")
+	}
+
+	// Rereading applies nothing
+	if state := server.State("old"); state != "RUNNING" {
+		t.Errorf("old is %s after a reread, want RUNNING", state)
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	server := newReloadServer(t)
+	client := newTestClient(t, server, supervisor.Options{})
+	changes, err := client.ReloadConfig(context.Background())
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+
+	before := len(server.Calls())
+	if err := client.UpdateConfig(context.Background(), changes); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	// Removed groups are stopped and unloaded, changed ones also loaded
+	// again, added ones only loaded
+	want := []string{
+		"supervisor.stopProcessGroup", "supervisor.removeProcessGroup",
+		"supervisor.stopProcessGroup", "supervisor.removeProcessGroup", "supervisor.addProcessGroup",
+		"supervisor.addProcessGroup",
+	}
+	if calls := server.Calls()[before:]; !reflect.DeepEqual(calls, want) {
+		t.Errorf("UpdateConfig called %v, want %v", calls, want)
+	}
+	for name, want := range map[string]string{"web": "RUNNING", "worker": "RUNNING", "cron": "RUNNING", "old": ""} {
+		if state := server.State(name); state != want {
+			t.Errorf("%s is %q after the update, want %q", name, state, want)
+		}
+	}
+
+	changes, err = client.ReloadConfig(context.Background())
+	if err != nil || !changes.Empty() {
+		t.Errorf("ReloadConfig after the update = %+v, %v, want no changes", changes, err)
+	}
+}
+
+func TestUpdateConfigKeepsGoing(t *testing.T) {
+	server := newReloadServer(t)
+	client := newTestClient(t, server, supervisor.Options{})
+	changes, err := client.ReloadConfig(context.Background())
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+
+	server.FailMethod("supervisor.addProcessGroup", supervisor.FaultFailed, "FAILED: no space left")
+	err = client.UpdateConfig(context.Background(), changes)
+	if err == nil || !strings.Contains(err.Error(), "2 group(s)") ||
+		!strings.Contains(err.Error(), "worker") || !strings.Contains(err.Error(), "cron") {
+		t.Errorf("UpdateConfig error = %v, want worker and cron failed", err)
+	}
+	// The removal went through regardless
+	if state := server.State("old"); state != "" {
+		t.Errorf("old is %q, want removed", state)
+	}
+}
@@ -0,0 +1,928 @@
+// Package supervisortest runs a fake supervisord that speaks XML-RPC over
+// HTTP, so the bot can be exercised end to end without a real server.
+package supervisortest
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kolo/xmlrpc"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+)
+
+// Process is the scriptable state of one fake process
+type Process struct {
+	Name        string
+	Group       string // defaults to Name
+	State       string // defaults to "STOPPED"
+	Description string
+	Pid         int
+	Start       time.Time
+	Stop        time.Time
+	ExitStatus  int
+	SpawnErr    string
+	Stdout      string // contents of the stdout log
+	Stderr      string // contents of the stderr log
+	Stdin       string // everything written with sendProcessStdin
+	Command     string // defaults to /usr/bin/<name>
+}
+
+func (p *Process) fullName() string {
+	if p.Group == p.Name {
+		return p.Name
+	}
+	return p.Group + ":" + p.Name
+}
+
+// Fault is a scripted XML-RPC fault
+type Fault struct {
+	Code   int
+	String string
+}
+
+// Server is a fake supervisord listening on a local HTTP port
+type Server struct {
+	URL string // XML-RPC endpoint, usable as a SERVER_URLS entry
+
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	processes map[string]*Process // keyed by "group:name"
+	faults    map[string]Fault    // keyed by method name
+	delays    map[string]time.Duration
+	calls     []string
+	username  string
+	password  string
+	nextPid   int
+	state     string             // supervisord state
+	pid       int                // supervisord PID
+	config    map[string]Process // config on disk after SetConfig, keyed by "group:name"
+	mainLog   string             // contents of the supervisord log
+}
+
+// NewServer starts a fake supervisord without processes
+func NewServer() *Server {
+	s := newServer()
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL + "/RPC2"
+	return s
+}
+
+// NewTLSServer starts a fake supervisord behind HTTPS, its self-signed
+// certificate is returned by Certificate
+func NewTLSServer() *Server {
+	s := newServer()
+	s.srv = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL + "/RPC2"
+	return s
+}
+
+func newServer() *Server {
+	return &Server{
+		processes: make(map[string]*Process),
+		faults:    make(map[string]Fault),
+		delays:    make(map[string]time.Duration),
+		nextPid:   1000,
+		state:     "RUNNING",
+		pid:       1,
+	}
+}
+
+// Certificate returns the certificate of a server started with NewTLSServer
+func (s *Server) Certificate() *x509.Certificate {
+	return s.srv.Certificate()
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SetAuth makes the server require HTTP basic auth with these credentials
+func (s *Server) SetAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username, s.password = username, password
+}
+
+// AddProcess registers a process, replacing one with the same name
+func (s *Server) AddProcess(p Process) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.Group == "" {
+		p.Group = p.Name
+	}
+	if p.State == "" {
+		p.State = "STOPPED"
+	}
+	if p.State == "RUNNING" && p.Pid == 0 {
+		p.Pid = s.allocPid()
+	}
+	if p.State == "RUNNING" && p.Start.IsZero() {
+		p.Start = time.Now()
+	}
+	s.processes[p.fullName()] = &p
+}
+
+// SetState moves a process to a new state, as if supervisord had done it.
+// Leaving RUNNING records the stop time and exit status.
+func (s *Server) SetState(name, state string, exitStatus int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("supervisortest: unknown process %q", name))
+	}
+	s.transition(p, state)
+	p.ExitStatus = exitStatus
+}
+
+// State returns the current state of a process
+func (s *Server) State(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.lookup(name); ok {
+		return p.State
+	}
+	return ""
+}
+
+// SetDaemonState sets the supervisord state reported by getState, e.g.
+// "RUNNING", "RESTARTING" or "SHUTDOWN"
+func (s *Server) SetDaemonState(state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+}
+
+// Restart simulates a supervisord restart: it gets a new PID, and processes
+// are stopped and started again
+func (s *Server) Restart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pid = s.allocPid()
+	for _, p := range s.processes {
+		if p.State == "RUNNING" {
+			s.transition(p, "STOPPED")
+			s.transition(p, "RUNNING")
+		}
+	}
+}
+
+// SetConfig replaces the configuration on disk with these processes. Until
+// reloadConfig and addProcessGroup/removeProcessGroup are called the running
+// processes are unchanged, as with a real supervisord.
+func (s *Server) SetConfig(processes ...Process) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.config = make(map[string]Process)
+	for _, p := range processes {
+		if p.Group == "" {
+			p.Group = p.Name
+		}
+		s.config[p.fullName()] = p
+	}
+}
+
+// Stdin returns everything sent to a process's stdin so far
+func (s *Server) Stdin(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.lookup(name); ok {
+		return p.Stdin
+	}
+	return ""
+}
+
+// AppendDaemonLog appends text to the supervisord main log
+func (s *Server) AppendDaemonLog(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mainLog += text
+}
+
+// DaemonLog returns the supervisord main log
+func (s *Server) DaemonLog() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mainLog
+}
+
+// AppendLog appends text to a process log, stream is "stdout" or "stderr"
+func (s *Server) AppendLog(name, stream, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.lookup(name)
+	if !ok {
+		panic(fmt.Sprintf("supervisortest: unknown process %q", name))
+	}
+	if stream == "stderr" {
+		p.Stderr += text
+	} else {
+		p.Stdout += text
+	}
+}
+
+// FailMethod makes every call of method (e.g. "supervisor.stopProcess")
+// return the fault until ClearFault is called
+func (s *Server) FailMethod(method string, code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[method] = Fault{Code: code, String: message}
+}
+
+// ClearFault removes a fault set with FailMethod
+func (s *Server) ClearFault(method string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.faults, method)
+}
+
+// DelayMethod makes calls of method wait before answering, to simulate a
+// hung server. A zero delay removes it.
+func (s *Server) DelayMethod(method string, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if delay == 0 {
+		delete(s.delays, method)
+		return
+	}
+	s.delays[method] = delay
+}
+
+// Calls returns the names of the methods called so far, in order
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// methodCall mirrors an XML-RPC request body
+type methodCall struct {
+	MethodName string `xml:"methodName"`
+	Params     []struct {
+		Value struct {
+			Inner []byte `xml:",innerxml"`
+		} `xml:"value"`
+	} `xml:"params>param"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	username, password := s.username, s.password
+	s.mu.Unlock()
+
+	if username != "" || password != "" {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != username || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var call methodCall
+	if err := xml.Unmarshal(body, &call); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	args := make([]interface{}, len(call.Params))
+	for i, param := range call.Params {
+		value := append(append([]byte("<value>"), param.Value.Inner...), "</value>"...)
+		if err := xmlrpc.Response(value).Unmarshal(&args[i]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	delay := s.delays[call.MethodName]
+	s.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	result, fault := s.dispatch(call.MethodName, args)
+	w.Header().Set("Content-Type", "text/xml")
+	if fault != nil {
+		w.Write(encodeFault(*fault))
+		return
+	}
+	response, err := encodeResponse(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(response)
+}
+
+// dispatch runs one XML-RPC method against the fake state
+func (s *Server) dispatch(method string, args []interface{}) (interface{}, *Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.invoke(method, args)
+}
+
+// invoke runs a method with s.mu held
+func (s *Server) invoke(method string, args []interface{}) (interface{}, *Fault) {
+	s.calls = append(s.calls, method)
+	if fault, ok := s.faults[method]; ok {
+		return nil, &fault
+	}
+
+	switch method {
+	case "system.multicall":
+		calls, _ := args[0].([]interface{})
+		results := []interface{}{}
+		for _, c := range calls {
+			call, _ := c.(map[string]interface{})
+			name, _ := call["methodName"].(string)
+			params, _ := call["params"].([]interface{})
+			result, fault := s.invoke(name, params)
+			if fault != nil {
+				results = append(results, map[string]interface{}{
+					"faultCode":   fault.Code,
+					"faultString": fault.String,
+				})
+				continue
+			}
+			results = append(results, []interface{}{result})
+		}
+		return results, nil
+
+	case "supervisor.getState":
+		return map[string]interface{}{
+			"statecode": daemonStateCode(s.state),
+			"statename": s.state,
+		}, nil
+
+	case "supervisor.getPID":
+		return s.pid, nil
+
+	case "supervisor.getSupervisorVersion":
+		return "4.2.5", nil
+
+	case "supervisor.getIdentification":
+		return "supervisor", nil
+
+	case "supervisor.getProcessInfo":
+		p, fault := s.processArg(args)
+		if fault != nil {
+			return nil, fault
+		}
+		return processInfo(p), nil
+
+	case "supervisor.getAllConfigInfo":
+		infos := []interface{}{}
+		for _, p := range s.sorted() {
+			infos = append(infos, configInfo(p))
+		}
+		return infos, nil
+
+	case "supervisor.getAllProcessInfo":
+		infos := []interface{}{}
+		for _, p := range s.sorted() {
+			infos = append(infos, processInfo(p))
+		}
+		return infos, nil
+
+	case "supervisor.startProcess":
+		p, fault := s.processArg(args)
+		if fault != nil {
+			return nil, fault
+		}
+		if fault := s.start(p); fault != nil {
+			return nil, fault
+		}
+		return true, nil
+
+	case "supervisor.stopProcess":
+		p, fault := s.processArg(args)
+		if fault != nil {
+			return nil, fault
+		}
+		if fault := s.stop(p); fault != nil {
+			return nil, fault
+		}
+		return true, nil
+
+	case "supervisor.signalProcess":
+		p, fault := s.processArg(args)
+		if fault != nil {
+			return nil, fault
+		}
+		if p.State != "RUNNING" {
+			return nil, &Fault{supervisor.FaultNotRunning, "NOT_RUNNING: " + p.fullName()}
+		}
+		return true, nil
+
+	case "supervisor.sendProcessStdin":
+		p, fault := s.processArg(args)
+		if fault != nil {
+			return nil, fault
+		}
+		chars, ok := stringArg(args, 1)
+		if !ok {
+			return nil, &Fault{supervisor.FaultIncorrectParameters, "INCORRECT_PARAMETERS"}
+		}
+		if p.State != "RUNNING" {
+			return nil, &Fault{supervisor.FaultNotRunning, "NOT_RUNNING: " + p.fullName()}
+		}
+		p.Stdin += chars
+		return true, nil
+
+	case "supervisor.startProcessGroup", "supervisor.stopProcessGroup":
+		group, _ := stringArg(args, 0)
+		var members []*Process
+		for _, p := range s.sorted() {
+			if p.Group == group {
+				members = append(members, p)
+			}
+		}
+		if len(members) == 0 {
+			return nil, &Fault{supervisor.FaultBadName, "BAD_NAME: " + group}
+		}
+		return s.applyAll(members, method == "supervisor.startProcessGroup"), nil
+
+	case "supervisor.startAllProcesses", "supervisor.stopAllProcesses":
+		return s.applyAll(s.sorted(), method == "supervisor.startAllProcesses"), nil
+
+	case "supervisor.signalAllProcesses":
+		results := []interface{}{}
+		for _, p := range s.sorted() {
+			if p.State == "RUNNING" {
+				results = append(results, statusInfo(p, supervisor.FaultSuccess, "OK"))
+			}
+		}
+		return results, nil
+
+	case "supervisor.readLog":
+		offset, _ := intArg(args, 0)
+		length, _ := intArg(args, 1)
+		return readLog(s.mainLog, offset, length)
+
+	case "supervisor.clearLog":
+		s.mainLog = ""
+		return true, nil
+
+	case "supervisor.reloadConfig":
+		added, changed, removed := s.configChanges()
+		return []interface{}{[]interface{}{added, changed, removed}}, nil
+
+	case "supervisor.addProcessGroup":
+		group, _ := stringArg(args, 0)
+		for _, p := range s.processes {
+			if p.Group == group {
+				return nil, &Fault{supervisor.FaultAlreadyAdded, "ALREADY_ADDED: " + group}
+			}
+		}
+		var members []Process
+		for _, p := range s.config {
+			if p.Group == group {
+				members = append(members, p)
+			}
+		}
+		if len(members) == 0 {
+			return nil, &Fault{supervisor.FaultBadName, "BAD_NAME: " + group}
+		}
+		for _, p := range members {
+			p.State = "STOPPED"
+			added := p
+			s.processes[added.fullName()] = &added
+			s.start(&added)
+		}
+		return true, nil
+
+	case "supervisor.removeProcessGroup":
+		group, _ := stringArg(args, 0)
+		var members []string
+		for name, p := range s.processes {
+			if p.Group != group {
+				continue
+			}
+			if p.State == "RUNNING" || p.State == "STARTING" || p.State == "BACKOFF" {
+				return nil, &Fault{supervisor.FaultStillRunning, "STILL_RUNNING: " + group}
+			}
+			members = append(members, name)
+		}
+		if len(members) == 0 {
+			return nil, &Fault{supervisor.FaultBadName, "BAD_NAME: " + group}
+		}
+		for _, name := range members {
+			delete(s.processes, name)
+		}
+		return true, nil
+
+	case "supervisor.tailProcessStdoutLog", "supervisor.tailProcessStderrLog":
+		p, fault := s.processArg(args)
+		if fault != nil {
+			return nil, fault
+		}
+		offset, _ := intArg(args, 1)
+		length, _ := intArg(args, 2)
+		data, newOffset, overflow := tailLog(p.log(method), offset, length)
+		return []interface{}{data, newOffset, overflow}, nil
+
+	case "supervisor.readProcessStdoutLog", "supervisor.readProcessStderrLog":
+		p, fault := s.processArg(args)
+		if fault != nil {
+			return nil, fault
+		}
+		offset, _ := intArg(args, 1)
+		length, _ := intArg(args, 2)
+		return readLog(p.log(method), offset, length)
+	}
+
+	return nil, &Fault{supervisor.FaultUnknownMethod, "UNKNOWN_METHOD"}
+}
+
+// configChanges compares the config on disk with the loaded processes by
+// group, like supervisord's diff_to_active
+func (s *Server) configChanges() (added, changed, removed []interface{}) {
+	added, changed, removed = []interface{}{}, []interface{}{}, []interface{}{}
+	if s.config == nil {
+		return added, changed, removed
+	}
+
+	loaded := make(map[string]map[string]string) // group -> name -> command
+	for _, p := range s.processes {
+		if loaded[p.Group] == nil {
+			loaded[p.Group] = make(map[string]string)
+		}
+		loaded[p.Group][p.Name] = p.command()
+	}
+	onDisk := make(map[string]map[string]string)
+	for _, p := range s.config {
+		if onDisk[p.Group] == nil {
+			onDisk[p.Group] = make(map[string]string)
+		}
+		onDisk[p.Group][p.Name] = p.command()
+	}
+
+	for _, group := range sortedKeys(onDisk) {
+		current, ok := loaded[group]
+		switch {
+		case !ok:
+			added = append(added, group)
+		case !sameCommands(current, onDisk[group]):
+			changed = append(changed, group)
+		}
+	}
+	for _, group := range sortedKeys(loaded) {
+		if _, ok := onDisk[group]; !ok {
+			removed = append(removed, group)
+		}
+	}
+	return added, changed, removed
+}
+
+func sortedKeys(m map[string]map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sameCommands(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, command := range a {
+		if other, ok := b[name]; !ok || other != command {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup finds a process by "group:name" or plain name
+func (s *Server) lookup(name string) (*Process, bool) {
+	if p, ok := s.processes[name]; ok {
+		return p, true
+	}
+	for _, p := range s.processes {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) processArg(args []interface{}) (*Process, *Fault) {
+	name, ok := stringArg(args, 0)
+	if !ok {
+		return nil, &Fault{supervisor.FaultIncorrectParameters, "INCORRECT_PARAMETERS"}
+	}
+	// Like supervisord, grouped processes are only known by "group:name"
+	p, ok := s.processes[name]
+	if !ok {
+		return nil, &Fault{supervisor.FaultBadName, "BAD_NAME: " + name}
+	}
+	return p, nil
+}
+
+// sorted returns processes ordered like supervisord does, by group then name
+func (s *Server) sorted() []*Process {
+	processes := make([]*Process, 0, len(s.processes))
+	for _, p := range s.processes {
+		processes = append(processes, p)
+	}
+	sort.Slice(processes, func(i, j int) bool {
+		return processes[i].fullName() < processes[j].fullName()
+	})
+	return processes
+}
+
+func (s *Server) allocPid() int {
+	s.nextPid++
+	return s.nextPid
+}
+
+func (s *Server) transition(p *Process, state string) {
+	wasRunning := p.State == "RUNNING"
+	p.State = state
+	switch {
+	case state == "RUNNING" && !wasRunning:
+		p.Pid = s.allocPid()
+		p.Start = time.Now()
+	case state != "RUNNING" && wasRunning:
+		p.Pid = 0
+		p.Stop = time.Now()
+	}
+}
+
+func (s *Server) start(p *Process) *Fault {
+	if p.State == "RUNNING" {
+		return &Fault{supervisor.FaultAlreadyStarted, "ALREADY_STARTED: " + p.fullName()}
+	}
+	s.transition(p, "RUNNING")
+	p.SpawnErr = ""
+	return nil
+}
+
+func (s *Server) stop(p *Process) *Fault {
+	if p.State != "RUNNING" && p.State != "STARTING" && p.State != "BACKOFF" {
+		return &Fault{supervisor.FaultNotRunning, "NOT_RUNNING: " + p.fullName()}
+	}
+	s.transition(p, "STOPPED")
+	return nil
+}
+
+// applyAll starts or stops processes and reports per-process results the way
+// the group methods of supervisord do
+func (s *Server) applyAll(processes []*Process, start bool) []interface{} {
+	results := []interface{}{}
+	for _, p := range processes {
+		var fault *Fault
+		if start {
+			if p.State == "RUNNING" {
+				continue
+			}
+			fault = s.start(p)
+		} else {
+			if p.State != "RUNNING" && p.State != "STARTING" && p.State != "BACKOFF" {
+				continue
+			}
+			fault = s.stop(p)
+		}
+		if fault != nil {
+			results = append(results, statusInfo(p, fault.Code, fault.String))
+			continue
+		}
+		results = append(results, statusInfo(p, supervisor.FaultSuccess, "OK"))
+	}
+	return results
+}
+
+func (p *Process) log(method string) string {
+	if strings.Contains(method, "Stderr") {
+		return p.Stderr
+	}
+	return p.Stdout
+}
+
+func processInfo(p *Process) map[string]interface{} {
+	now := time.Now()
+	description := p.Description
+	if description == "" && p.State == "RUNNING" {
+		description = fmt.Sprintf("pid %d, uptime %s", p.Pid, now.Sub(p.Start).Round(time.Second))
+	}
+	return map[string]interface{}{
+		"name":           p.Name,
+		"group":          p.Group,
+		"description":    description,
+		"start":          unix(p.Start),
+		"stop":           unix(p.Stop),
+		"now":            now.Unix(),
+		"state":          stateCode(p.State),
+		"statename":      p.State,
+		"spawnerr":       p.SpawnErr,
+		"exitstatus":     p.ExitStatus,
+		"logfile":        "/var/log/" + p.Name + ".log",
+		"stdout_logfile": "/var/log/" + p.Name + ".log",
+		"stderr_logfile": "/var/log/" + p.Name + ".err.log",
+		"pid":            p.Pid,
+	}
+}
+
+func (p *Process) command() string {
+	if p.Command == "" {
+		return "/usr/bin/" + p.Name
+	}
+	return p.Command
+}
+
+func configInfo(p *Process) map[string]interface{} {
+	command := p.command()
+	return map[string]interface{}{
+		"name":           p.Name,
+		"group":          p.Group,
+		"command":        command,
+		"directory":      "none",
+		"autostart":      true,
+		"autorestart":    "unexpected",
+		"startsecs":      1,
+		"startretries":   3,
+		"stopsignal":     "TERM",
+		"stopwaitsecs":   10,
+		"process_prio":   999,
+		"group_prio":     999,
+		"inuse":          true,
+		"stdout_logfile": "/var/log/" + p.Name + ".log",
+		"stderr_logfile": "/var/log/" + p.Name + ".err.log",
+	}
+}
+
+func statusInfo(p *Process, code int, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        p.Name,
+		"group":       p.Group,
+		"status":      code,
+		"description": description,
+	}
+}
+
+// stateCode maps a state name to supervisord's numeric process state
+func stateCode(state string) int {
+	codes := map[string]int{
+		"STOPPED":  0,
+		"STARTING": 10,
+		"RUNNING":  20,
+		"BACKOFF":  30,
+		"STOPPING": 40,
+		"EXITED":   100,
+		"FATAL":    200,
+		"UNKNOWN":  1000,
+	}
+	if code, ok := codes[state]; ok {
+		return code
+	}
+	return 1000
+}
+
+// daemonStateCode maps a supervisord state name to its numeric code
+func daemonStateCode(state string) int {
+	switch state {
+	case "FATAL":
+		return 2
+	case "RUNNING":
+		return 1
+	case "RESTARTING":
+		return 0
+	case "SHUTDOWN":
+		return -1
+	}
+	return 1
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// tailLog mirrors supervisor.options.tailFile
+func tailLog(data string, offset, length int64) (string, int64, bool) {
+	size := int64(len(data))
+	overflow := false
+	if size > offset+length {
+		overflow = true
+		offset = size - 1
+	}
+	if offset+length > size {
+		if offset > size-1 {
+			length = 0
+		}
+		offset = size - length
+		if offset < 0 {
+			offset = 0
+		}
+		if length < 0 {
+			length = 0
+		}
+	}
+	if length == 0 {
+		return "", size, overflow
+	}
+	return data[offset : offset+length], size, overflow
+}
+
+// readLog mirrors supervisor.options.readFile
+func readLog(data string, offset, length int64) (interface{}, *Fault) {
+	size := int64(len(data))
+	if offset < 0 {
+		if length != 0 {
+			return nil, &Fault{supervisor.FaultBadArguments, "BAD_ARGUMENTS"}
+		}
+		start := size + offset
+		if start < 0 {
+			start = 0
+		}
+		return data[start:], nil
+	}
+	if length < 0 {
+		return nil, &Fault{supervisor.FaultBadArguments, "BAD_ARGUMENTS"}
+	}
+	if offset > size {
+		offset = size
+	}
+	end := size
+	if length > 0 && offset+length < size {
+		end = offset + length
+	}
+	return data[offset:end], nil
+}
+
+func stringArg(args []interface{}, i int) (string, bool) {
+	if i >= len(args) {
+		return "", false
+	}
+	value, ok := args[i].(string)
+	return value, ok
+}
+
+func intArg(args []interface{}, i int) (int64, bool) {
+	if i >= len(args) {
+		return 0, false
+	}
+	value, ok := args[i].(int64)
+	return value, ok
+}
+
+// encodeResponse builds a methodResponse. The xmlrpc package only exposes an
+// encoder for calls, so the call envelope is swapped for a response one.
+func encodeResponse(result interface{}) ([]byte, error) {
+	call, err := xmlrpc.EncodeMethodCall("response", result)
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(call, []byte("<params>"))
+	end := bytes.LastIndex(call, []byte("</methodCall>"))
+	if start == -1 || end == -1 {
+		return nil, fmt.Errorf("unexpected encoding of %T", result)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><methodResponse>`)
+	b.Write(call[start:end])
+	b.WriteString("</methodResponse>")
+	return b.Bytes(), nil
+}
+
+func encodeFault(fault Fault) []byte {
+	var message bytes.Buffer
+	xml.EscapeText(&message, []byte(fault.String))
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><methodResponse><fault><value><struct>`+
+		`<member><name>faultCode</name><value><int>%d</int></value></member>`+
+		`<member><name>faultString</name><value><string>%s</string></value></member>`+
+		`</struct></value></fault></methodResponse>`, fault.Code, message.String()))
+}
@@ -0,0 +1,139 @@
+package supervisor_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+)
+
+func TestBasicAuth(t *testing.T) {
+	server := supervisortest.NewServer()
+	defer server.Close()
+	server.SetAuth("alice", "secret")
+
+	tests := []struct {
+		name string
+		auth *supervisor.BasicAuth
+		ok   bool
+	}{
+		{name: "right credentials", auth: &supervisor.BasicAuth{Username: "alice", Password: "secret"}, ok: true},
+		{name: "wrong password", auth: &supervisor.BasicAuth{Username: "alice", Password: "guess"}},
+		{name: "no credentials"},
+	}
+	for _, tt := range tests {
+		client := newTestClient(t, server, supervisor.Options{Auth: tt.auth})
+		_, err := client.GetState(context.Background())
+		if tt.ok && err != nil {
+			t.Errorf("%s: GetState = %v", tt.name, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "401")) {
+			t.Errorf("%s: GetState = %v, want a 401 error", tt.name, err)
+		}
+	}
+}
+
+// writeCA saves the server's self-signed certificate as a PEM bundle
+func writeCA(t *testing.T, server *supervisortest.Server) string {
+	t.Helper()
+	return writePEM(t, server.Certificate().Raw)
+}
+
+// writeUnrelatedCA saves a fresh self-signed CA that signed nothing the
+// server presents. All httptest servers share one certificate, so it has to
+// be made here.
+func writeUnrelatedCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "unrelated CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, der)
+}
+
+func writePEM(t *testing.T, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTLS(t *testing.T) {
+	server := supervisortest.NewTLSServer()
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		tls  *supervisor.TLSOptions
+		ok   bool
+	}{
+		{name: "server CA", tls: &supervisor.TLSOptions{CAFile: writeCA(t, server)}, ok: true},
+		{name: "skip verification", tls: &supervisor.TLSOptions{InsecureSkipVerify: true}, ok: true},
+		{name: "system roots", tls: &supervisor.TLSOptions{}},
+		{name: "no TLS options"},
+		{name: "unrelated CA", tls: &supervisor.TLSOptions{CAFile: writeUnrelatedCA(t)}},
+	}
+	for _, tt := range tests {
+		client := newTestClient(t, server, supervisor.Options{TLS: tt.tls})
+		_, err := client.GetState(context.Background())
+		if tt.ok && err != nil {
+			t.Errorf("%s: GetState = %v", tt.name, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "certificate")) {
+			t.Errorf("%s: GetState = %v, want a certificate error", tt.name, err)
+		}
+	}
+}
+
+func TestTLSOptionErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tls     supervisor.TLSOptions
+		wantErr string
+	}{
+		{name: "missing CA file", tls: supervisor.TLSOptions{CAFile: filepath.Join(dir, "missing.pem")}, wantErr: "failed to read CA bundle"},
+		{name: "CA file without certificates", tls: supervisor.TLSOptions{CAFile: notPEM}, wantErr: "no certificates found"},
+		{name: "certificate without key", tls: supervisor.TLSOptions{CertFile: notPEM}, wantErr: "failed to load client certificate"},
+		{name: "key without certificate", tls: supervisor.TLSOptions{KeyFile: notPEM}, wantErr: "failed to load client certificate"},
+	}
+	for _, tt := range tests {
+		_, err := supervisor.NewClient("https://127.0.0.1:9001/RPC2", supervisor.Options{TLS: &tt.tls})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: NewClient error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package supervisor_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor/supervisortest"
+)
+
+// serveUnix forwards HTTP requests on a unix socket to a fake supervisord,
+// the way [unix_http_server] exposes the same XML-RPC interface, and returns
+// the socket's unix:// URL and the paths requested
+func serveUnix(t *testing.T, server *supervisortest.Server) (string, *atomic.Value) {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes, keep it short
+	dir, err := os.MkdirTemp("", "sv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "supervisor.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen on %s: %v", socket, err)
+	}
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: target.Scheme, Host: target.Host})
+	var path atomic.Value
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path.Store(r.URL.Path)
+		proxy.ServeHTTP(w, r)
+	})}
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return "unix://" + socket, &path
+}
+
+func TestUnixSocket(t *testing.T) {
+	server := supervisortest.NewServer()
+	defer server.Close()
+	server.AddProcess(supervisortest.Process{Name: "web", State: "RUNNING"})
+	socketURL, path := serveUnix(t, server)
+
+	client, err := supervisor.NewClient(socketURL, supervisor.Options{})
+	if err != nil {
+		t.Fatalf("NewClient(%s): %v", socketURL, err)
+	}
+	defer client.Close()
+
+	snapshot, err := client.GetSnapshot(context.Background(), false)
+	if err != nil {
+		t.Fatalf("GetSnapshot over the socket: %v", err)
+	}
+	if len(snapshot.Processes) != 1 || snapshot.Processes[0].Name != "web" {
+		t.Errorf("processes = %+v, want web", snapshot.Processes)
+	}
+	if got := path.Load(); got != "/RPC2" {
+		t.Errorf("requested %v, want /RPC2", got)
+	}
+	if err := client.StopProcess(context.Background(), "web"); err != nil || server.State("web") != "STOPPED" {
+		t.Errorf("StopProcess over the socket = %v, web %s", err, server.State("web"))
+	}
+}
+
+func TestUnixSocketMissing(t *testing.T) {
+	client, err := supervisor.NewClient("unix://"+filepath.Join(t.TempDir(), "missing.sock"), supervisor.Options{})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.GetSnapshot(context.Background(), false); err == nil {
+		t.Error("GetSnapshot on a missing socket succeeded")
+	}
+}
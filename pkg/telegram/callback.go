@@ -0,0 +1,207 @@
+package telegram
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+)
+
+// Callback is what an inline button does: an action, the server and process
+// or group it targets, and any extra arguments such as a log offset
+type Callback struct {
+	Action    string
+	ServerURL string
+	Target    string
+	Args      []string
+}
+
+// Arg returns the i-th extra argument, or "" when there is none
+func (c Callback) Arg(i int) string {
+	if i < len(c.Args) {
+		return c.Args[i]
+	}
+	return ""
+}
+
+// callbackTokenLen keeps callback data far below Telegram's 64-byte limit
+const callbackTokenLen = 16
+
+// callbackRegistry maps short tokens sent as callback data to the callbacks
+// they stand for. Tokens are derived from the callback, so the same button
+// always gets the same token.
+type callbackRegistry struct {
+	mu        sync.Mutex
+	entries   map[string]callbackEntry
+	lastSweep time.Time
+	version   uint64 // bumped on every change of entries
+}
+
+type callbackEntry struct {
+	callback Callback
+	expires  time.Time
+}
+
+var callbacks = &callbackRegistry{entries: make(map[string]callbackEntry)}
+
+// EncodeCallback registers a callback for CALLBACK_TTL and returns the token
+// to use as button data. Encoding it again extends its lifetime.
+func EncodeCallback(callback Callback) string {
+	return callbacks.encode(callback, time.Now())
+}
+
+// DecodeCallback resolves button data created by EncodeCallback or restored
+// with RestoreCallbacks. It fails for unknown and expired tokens.
+func DecodeCallback(data string) (Callback, bool) {
+	return callbacks.decode(data, time.Now())
+}
+
+// RegisteredCallback is a callback with its token and expiry, as saved
+// across restarts
+type RegisteredCallback struct {
+	Token    string
+	Callback Callback
+	Expires  time.Time
+}
+
+// RegisteredCallbacks drops expired callbacks and returns the ones whose
+// tokens still work, ordered by token
+func RegisteredCallbacks() []RegisteredCallback {
+	return callbacks.live(time.Now())
+}
+
+// RestoreCallbacks registers callbacks saved by an earlier run under their
+// old tokens, so buttons sent before a restart keep working until they expire
+func RestoreCallbacks(saved []RegisteredCallback) {
+	callbacks.restore(saved, time.Now())
+}
+
+// CallbacksVersion changes whenever a callback is registered, extended or
+// dropped, so savers can tell whether RegisteredCallbacks changed
+func CallbacksVersion() uint64 {
+	callbacks.mu.Lock()
+	defer callbacks.mu.Unlock()
+	return callbacks.version
+}
+
+// CallbackButton is an inline button running callback
+func CallbackButton(text string, callback Callback) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, EncodeCallback(callback))
+}
+
+func (r *callbackRegistry) encode(callback Callback, now time.Time) string {
+	// Unit separators can't appear in names or URLs, so keys don't collide
+	key := strings.Join(append([]string{callback.Action, callback.ServerURL, callback.Target}, callback.Args...), "\x1f")
+	sum := sha256.Sum256([]byte(key))
+	token := base64.RawURLEncoding.EncodeToString(sum[:])[:callbackTokenLen]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[token] = callbackEntry{callback: callback, expires: now.Add(config.CallbackTTL)}
+	r.version++
+	if now.Sub(r.lastSweep) > config.CallbackTTL {
+		r.sweep(now)
+	}
+	return token
+}
+
+func (r *callbackRegistry) decode(token string, now time.Time) (Callback, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[token]
+	if !ok || now.After(entry.expires) {
+		return Callback{}, false
+	}
+	return entry.callback, true
+}
+
+func (r *callbackRegistry) live(now time.Time) []RegisteredCallback {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now)
+	registered := make([]RegisteredCallback, 0, len(r.entries))
+	for token, entry := range r.entries {
+		registered = append(registered, RegisteredCallback{Token: token, Callback: entry.callback, Expires: entry.expires})
+	}
+	sort.Slice(registered, func(i, j int) bool { return registered[i].Token < registered[j].Token })
+	return registered
+}
+
+func (r *callbackRegistry) restore(saved []RegisteredCallback, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, registered := range saved {
+		if now.After(registered.Expires) {
+			continue
+		}
+		// Buttons sent again since the start already live longer
+		if entry, ok := r.entries[registered.Token]; ok && entry.expires.After(registered.Expires) {
+			continue
+		}
+		r.entries[registered.Token] = callbackEntry{callback: registered.Callback, expires: registered.Expires}
+		r.version++
+	}
+}
+
+// sweep drops expired entries, r.mu must be held
+func (r *callbackRegistry) sweep(now time.Time) {
+	for token, entry := range r.entries {
+		if now.After(entry.expires) {
+			delete(r.entries, token)
+			r.version++
+		}
+	}
+	r.lastSweep = now
+}
+
+// DetailsCallback opens the details of a process
+func DetailsCallback(processName, serverURL string) Callback {
+	return Callback{Action: "details", ServerURL: serverURL, Target: processName}
+}
+
+// ProcessLogCallback shows the page of a process log ending at offset, -1
+// being the tail, or starting at offset when after is set
+func ProcessLogCallback(processName, serverURL, stream string, offset int64, after bool) Callback {
+	args := []string{stream, strconv.FormatInt(offset, 10)}
+	if after {
+		args = append(args, "after")
+	}
+	return Callback{Action: "log", ServerURL: serverURL, Target: processName, Args: args}
+}
+
+// DaemonLogCallback shows the page of the daemon log ending back bytes before
+// its end, or starting there when after is set
+func DaemonLogCallback(serverURL string, back int64, after bool) Callback {
+	args := []string{strconv.FormatInt(back, 10)}
+	if after {
+		args = append(args, "after")
+	}
+	return Callback{Action: "dlog", ServerURL: serverURL, Args: args}
+}
+
+// AuditCallback shows the page of /audit entries matching query that ends
+// before position offset, counted from the oldest entry, or starts there when
+// after is set
+func AuditCallback(query string, offset int, after bool) Callback {
+	args := []string{strconv.Itoa(offset)}
+	if after {
+		args = append(args, "after")
+	}
+	return Callback{Action: "audit", Target: query, Args: args}
+}
+
+// FindCallback shows a page of the processes matching a /find query, all
+// processes for an empty query
+func FindCallback(query string, page int) Callback {
+	return Callback{Action: "find", Target: query, Args: []string{strconv.Itoa(page)}}
+}
@@ -0,0 +1,132 @@
+package telegram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
+)
+
+func TestCallbackRegistry(t *testing.T) {
+	ttl := config.CallbackTTL
+	config.CallbackTTL = time.Hour
+	defer func() { config.CallbackTTL = ttl }()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	long := Callback{Action: "find", Target: strings.Repeat("web ", 40), Args: []string{"2"}}
+	tests := []struct {
+		name     string
+		callback Callback
+	}{
+		{name: "details", callback: DetailsCallback("group:web_01", "http://web1:9001/RPC2")},
+		{name: "log page", callback: ProcessLogCallback("web", "unix:///var/run/supervisor.sock", "stderr", 4096, true)},
+		{name: "long query", callback: long},
+		{name: "no server", callback: Callback{Action: "subs"}},
+	}
+	for _, tt := range tests {
+		r := &callbackRegistry{entries: make(map[string]callbackEntry)}
+		token := r.encode(tt.callback, now)
+		if len(token) != callbackTokenLen || len(token) > 64 {
+			t.Errorf("%s: token %q has length %d", tt.name, token, len(token))
+		}
+		if again := r.encode(tt.callback, now); again != token {
+			t.Errorf("%s: encoding again gave %q, want %q", tt.name, again, token)
+		}
+		got, ok := r.decode(token, now.Add(59*time.Minute))
+		if !ok || !reflect.DeepEqual(got, tt.callback) {
+			t.Errorf("%s: decode = %+v, %v, want %+v", tt.name, got, ok, tt.callback)
+		}
+		if _, ok := r.decode(token, now.Add(61*time.Minute)); ok {
+			t.Errorf("%s: decoded after the TTL", tt.name)
+		}
+	}
+}
+
+func TestCallbackTokensDiffer(t *testing.T) {
+	r := &callbackRegistry{entries: make(map[string]callbackEntry)}
+	now := time.Now()
+	callbacks := []Callback{
+		{Action: "stop", ServerURL: "http://a", Target: "web"},
+		{Action: "start", ServerURL: "http://a", Target: "web"},
+		{Action: "stop", ServerURL: "http://b", Target: "web"},
+		{Action: "stop", ServerURL: "http://a", Target: "web", Args: []string{"x"}},
+		// Fields are joined with a separator, moving text across them changes the token
+		{Action: "stop", ServerURL: "http://a", Target: "", Args: []string{"web"}},
+	}
+	seen := make(map[string]Callback)
+	for _, callback := range callbacks {
+		token := r.encode(callback, now)
+		if other, ok := seen[token]; ok {
+			t.Errorf("%+v and %+v share token %q", callback, other, token)
+		}
+		seen[token] = callback
+	}
+	if _, ok := r.decode("unknown-token-00", now); ok {
+		t.Error("decoded an unknown token")
+	}
+}
+
+func TestCallbackSweep(t *testing.T) {
+	ttl := config.CallbackTTL
+	config.CallbackTTL = time.Hour
+	defer func() { config.CallbackTTL = ttl }()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := &callbackRegistry{entries: make(map[string]callbackEntry), lastSweep: now}
+	old := r.encode(Callback{Action: "old"}, now)
+	kept := r.encode(Callback{Action: "kept"}, now.Add(50*time.Minute))
+
+	// The next encode after a TTL without sweeping drops expired entries
+	r.encode(Callback{Action: "new"}, now.Add(90*time.Minute))
+	if _, ok := r.entries[old]; ok {
+		t.Error("expired entry survived the sweep")
+	}
+	if _, ok := r.entries[kept]; !ok {
+		t.Error("live entry was swept")
+	}
+	if len(r.entries) != 2 {
+		t.Errorf("%d entries after the sweep, want 2", len(r.entries))
+	}
+}
+
+func TestCallbackRestore(t *testing.T) {
+	ttl := config.CallbackTTL
+	config.CallbackTTL = time.Hour
+	defer func() { config.CallbackTTL = ttl }()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	old := &callbackRegistry{entries: make(map[string]callbackEntry)}
+	details := old.encode(DetailsCallback("web", "http://a"), now)
+	old.encode(Callback{Action: "expired"}, now.Add(-2*time.Hour))
+	saved := old.live(now)
+	if len(saved) != 1 || saved[0].Token != details {
+		t.Fatalf("live = %+v, want only the details button", saved)
+	}
+	if len(old.entries) != 1 {
+		t.Errorf("%d entries after listing the live ones, want the expired one dropped", len(old.entries))
+	}
+
+	// A new run knows the saved token until it expires
+	r := &callbackRegistry{entries: make(map[string]callbackEntry)}
+	r.restore(saved, now.Add(time.Minute))
+	if got, ok := r.decode(details, now.Add(30*time.Minute)); !ok || got.Action != "details" || got.Target != "web" {
+		t.Errorf("decode of a restored token = %+v, %v", got, ok)
+	}
+	if _, ok := r.decode(details, now.Add(61*time.Minute)); ok {
+		t.Error("restored token outlived its saved expiry")
+	}
+
+	// Restoring doesn't cut short a button sent again since the start
+	r = &callbackRegistry{entries: make(map[string]callbackEntry)}
+	r.encode(DetailsCallback("web", "http://a"), now.Add(30*time.Minute))
+	r.restore(saved, now.Add(30*time.Minute))
+	if _, ok := r.decode(details, now.Add(80*time.Minute)); !ok {
+		t.Error("restore shortened the lifetime of a fresh button")
+	}
+	r.restore(saved, now.Add(2*time.Hour))
+	if len(r.live(now.Add(2*time.Hour))) != 0 {
+		t.Error("restored tokens that had expired")
+	}
+}
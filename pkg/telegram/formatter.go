@@ -1,10 +1,16 @@
 package telegram
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/rarebek/supervisor-tg-notifier/pkg/audit"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/state"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/supervisor"
 )
 
 func EscapeMarkdownV2(input string) string {
@@ -27,18 +33,53 @@ func FormatProcessList(processes []models.Process, page, totalPages int) string
 	return message
 }
 
+// FormatSearchResults renders one page of /find results. total counts the
+// matches on every page.
+func FormatSearchResults(query string, processes []models.Process, total, page, totalPages int) string {
+	var message strings.Builder
+	message.WriteString("*Search Results*")
+	if query != "" {
+		message.WriteString(fmt.Sprintf(" for `%s`", EscapeMarkdownV2(query)))
+	}
+	message.WriteString(fmt.Sprintf("\n%d matches \\(Page %d/%d\\)\n\n", total, page, totalPages))
+	for _, process := range processes {
+		message.WriteString(fmt.Sprintf("• `%s` *%s* on `%s`\n", EscapeMarkdownV2(process.FullName()),
+			EscapeMarkdownV2(process.State), EscapeMarkdownV2(process.ServerURL)))
+		if process.Description != "" {
+			message.WriteString(fmt.Sprintf("  %s\n", EscapeMarkdownV2(process.Description)))
+		}
+	}
+	return message.String()
+}
+
 func FormatProcessDetails(process models.Process) string {
 	escapedName := EscapeMarkdownV2(process.Name)
 	escapedState := EscapeMarkdownV2(process.State)
 	escapedDesc := EscapeMarkdownV2(process.Description)
 
-	return fmt.Sprintf("*Process Details*\n\n"+
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("*Process Details*\n\n"+
 		"*Name:* `%s`\n"+
 		"*Status:* `%s`\n"+
 		"*Description:* `%s`",
 		escapedName,
 		escapedState,
-		escapedDesc)
+		escapedDesc))
+
+	if process.Group != "" && process.Group != process.Name {
+		message.WriteString(fmt.Sprintf("\n*Group:* `%s`", EscapeMarkdownV2(process.Group)))
+	}
+	if process.Pid > 0 {
+		message.WriteString(fmt.Sprintf("\n*PID:* `%d`", process.Pid))
+	}
+	message.WriteString(formatRunInfo(process))
+	if process.StdoutLogfile != "" {
+		message.WriteString(fmt.Sprintf("\n*Stdout log:* `%s`", EscapeMarkdownV2(process.StdoutLogfile)))
+	}
+	if process.StderrLogfile != "" {
+		message.WriteString(fmt.Sprintf("\n*Stderr log:* `%s`", EscapeMarkdownV2(process.StderrLogfile)))
+	}
+	return message.String()
 }
 
 func FormatProcessStatusChange(process models.Process) string {
@@ -50,7 +91,46 @@ func FormatProcessStatusChange(process models.Process) string {
 		"*Name:* `%s`\n"+
 		"*Status:* `%s`\n"+
 		"*Error:* `%s`",
-		escapedName, escapedState, escapedDesc)
+		escapedName, escapedState, escapedDesc) + formatRunInfo(process)
+}
+
+// formatRunInfo renders uptime, last exit code and spawn error lines
+func formatRunInfo(process models.Process) string {
+	var info strings.Builder
+	if uptime := process.Uptime(); uptime > 0 {
+		label := "Uptime"
+		if process.State != "RUNNING" {
+			label = "Ran for"
+		}
+		info.WriteString(fmt.Sprintf("\n*%s:* `%s`", label, EscapeMarkdownV2(FormatDuration(uptime))))
+	}
+	if !process.Stop.IsZero() {
+		info.WriteString(fmt.Sprintf("\n*Last exit code:* `%d`", process.ExitStatus))
+	}
+	if process.SpawnErr != "" {
+		info.WriteString(fmt.Sprintf("\n*Spawn error:* `%s`", EscapeMarkdownV2(process.SpawnErr)))
+	}
+	return info.String()
+}
+
+// FormatDuration renders a duration as e.g. "3d 4h 12m" or "45s"
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	seconds := int(d.Seconds()) % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
 }
 
 func FormatAllProcessesList(processes []models.Process) string {
@@ -66,3 +146,273 @@ func FormatAllProcessesList(processes []models.Process) string {
 	}
 	return message
 }
+
+func FormatServerControls(serverURL string) string {
+	return fmt.Sprintf("*Server Controls*\n\n*Server:* `%s`", EscapeMarkdownV2(serverURL))
+}
+
+// EscapeMarkdownV2Code escapes text placed inside a ``` pre block, where only
+// backslashes and backticks are special
+func EscapeMarkdownV2Code(input string) string {
+	input = strings.ReplaceAll(input, "\\", "\\\\")
+	return strings.ReplaceAll(input, "`", "\\`")
+}
+
+func FormatProcessLog(processName, stream, text string, start, end int64) string {
+	if strings.TrimSpace(text) == "" {
+		text = "(empty)"
+	}
+	return fmt.Sprintf("*Log:* `%s` \\(%s, bytes %d\\-%d\\)\n```\n%s\n```",
+		EscapeMarkdownV2(processName), stream, start, end, EscapeMarkdownV2Code(text))
+}
+
+// FormatClientError renders a failed supervisor call, reporting a timed out
+// server separately from XML-RPC failures
+func FormatClientError(action, serverURL string, err error) string {
+	if errors.Is(err, supervisor.ErrBreakerOpen) {
+		return fmt.Sprintf("🔴 *Circuit breaker open*, skipped %s\n*Server:* `%s`",
+			EscapeMarkdownV2(action), EscapeMarkdownV2(serverURL))
+	}
+	if errors.Is(err, supervisor.ErrTimeout) {
+		return fmt.Sprintf("⏱ *Server timed out* while %s\n*Server:* `%s`",
+			EscapeMarkdownV2(action), EscapeMarkdownV2(serverURL))
+	}
+	if code, name, ok := supervisor.AsFault(err); ok {
+		return fmt.Sprintf("❌ *%s* \\(%d\\) while %s\n*Server:* `%s`\n`%s`",
+			EscapeMarkdownV2(name), code, EscapeMarkdownV2(action), EscapeMarkdownV2(serverURL), EscapeMarkdownV2(err.Error()))
+	}
+	return fmt.Sprintf("Error %s on `%s`: `%s`",
+		EscapeMarkdownV2(action), EscapeMarkdownV2(serverURL), EscapeMarkdownV2(err.Error()))
+}
+
+func FormatProcessOutput(serverURL, processName, stream, data string) string {
+	return fmt.Sprintf("*Process Output* `%s` \\(%s\\)\n*Server:* `%s`\n```\n%s\n```",
+		EscapeMarkdownV2(processName), stream, EscapeMarkdownV2(serverURL),
+		EscapeMarkdownV2Code(strings.ToValidUTF8(strings.TrimSuffix(data, "\n"), "")))
+}
+
+func FormatDaemonAlert(serverURL, title, details string) string {
+	return fmt.Sprintf("*%s*\n*Server:* `%s`\n`%s`",
+		EscapeMarkdownV2(title), EscapeMarkdownV2(serverURL), EscapeMarkdownV2(details))
+}
+
+// FormatDaemonHeader renders the per-server supervisord line of the status
+// summary. A non-exact uptime is a lower bound and is shown as such.
+func FormatDaemonHeader(snapshot supervisor.Snapshot, uptime time.Duration, exact bool, breaker supervisor.BreakerState) string {
+	header := fmt.Sprintf("supervisord `%s`", EscapeMarkdownV2(snapshot.Version))
+	if snapshot.Identification != "" {
+		header += fmt.Sprintf(" \\(%s\\)", EscapeMarkdownV2(snapshot.Identification))
+	}
+	header += fmt.Sprintf(" · %s · PID `%d`", EscapeMarkdownV2(snapshot.State), snapshot.PID)
+	if uptime > 0 {
+		bound := ""
+		if !exact {
+			bound = "≥ "
+		}
+		header += fmt.Sprintf(" · up %s`%s`", bound, EscapeMarkdownV2(FormatDuration(uptime)))
+	}
+	return header + "\n" + FormatBreakerState(breaker) + "\n"
+}
+
+// FormatBreakerState renders a server's circuit breaker state for the summary
+func FormatBreakerState(state supervisor.BreakerState) string {
+	icon := "🟢"
+	switch state {
+	case supervisor.BreakerOpen:
+		icon = "🔴"
+	case supervisor.BreakerHalfOpen:
+		icon = "🟡"
+	}
+	return fmt.Sprintf("%s breaker `%s`", icon, EscapeMarkdownV2(state.String()))
+}
+
+// FormatConfigChanges lists what a reread found on one server
+func FormatConfigChanges(serverURL string, changes supervisor.ConfigChanges) string {
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("*Server:* `%s`\n", EscapeMarkdownV2(serverURL)))
+	if changes.Empty() {
+		message.WriteString("No changes\n")
+		return message.String()
+	}
+	writeGroups := func(label string, groups []string) {
+		for _, group := range groups {
+			message.WriteString(fmt.Sprintf("%s `%s`\n", label, EscapeMarkdownV2(group)))
+		}
+	}
+	writeGroups("➕ added", changes.Added)
+	writeGroups("✏️ changed", changes.Changed)
+	writeGroups("➖ removed", changes.Removed)
+	return message.String()
+}
+
+// FormatDaemonLog renders a page of the supervisord main log. from and to are
+// byte offsets counted back from the end of the log.
+func FormatDaemonLog(serverURL, text string, from, to int64) string {
+	if strings.TrimSpace(text) == "" {
+		text = "(empty)"
+	}
+	return fmt.Sprintf("*supervisord log:* `%s` \\(bytes %d\\-%d from end\\)\n```\n%s\n```",
+		EscapeMarkdownV2(serverURL), from, to, EscapeMarkdownV2Code(text))
+}
+
+func FormatDaemonLogClearConfirm(serverURL string) string {
+	return fmt.Sprintf("🗑 *Clear the supervisord log?*\n*Server:* `%s`\n\nThis truncates the log file and cannot be undone\\.",
+		EscapeMarkdownV2(serverURL))
+}
+
+// FormatProcessConfig renders the configuration of a process and its state,
+// which is empty when unknown. groupSize is the number of processes in its
+// group, i.e. numprocs for a single program.
+func FormatProcessConfig(config models.ProcessConfig, serverURL, state string, groupSize int) string {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	field := func(label, value string) string {
+		return fmt.Sprintf("\n*%s:* `%s`", label, EscapeMarkdownV2Code(value))
+	}
+
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("*Process Config*\n\n*Name:* `%s`\n*Server:* `%s`",
+		EscapeMarkdownV2(config.FullName()), EscapeMarkdownV2(serverURL)))
+	message.WriteString(fmt.Sprintf("\n*Group:* `%s` \\(%d process", EscapeMarkdownV2(config.Group), groupSize))
+	if groupSize != 1 {
+		message.WriteString("es")
+	}
+	message.WriteString("\\)")
+	if state != "" {
+		message.WriteString(field("State", state))
+	}
+
+	message.WriteString("\n")
+	message.WriteString(field("Command", config.Command))
+	message.WriteString(field("Directory", config.Directory))
+	message.WriteString(field("Autostart", yesNo(config.Autostart)))
+	message.WriteString(field("Autorestart", config.Autorestart))
+	message.WriteString(field("Start secs", fmt.Sprint(config.StartSecs)))
+	message.WriteString(field("Start retries", fmt.Sprint(config.StartRetries)))
+	message.WriteString(field("Stop signal", config.StopSignal))
+	message.WriteString(field("Stop wait secs", fmt.Sprint(config.StopWaitSecs)))
+	message.WriteString(field("Priority", fmt.Sprint(config.Priority)))
+
+	message.WriteString("\n")
+	message.WriteString(field("Stdout log", config.StdoutLogfile))
+	message.WriteString(field("Stderr log", config.StderrLogfile))
+	if !config.InUse {
+		message.WriteString("\n\n⚠️ _Removed from the config files, still loaded until the next update_")
+	}
+	return message.String()
+}
+
+func FormatConfirmation(question string, timeout time.Duration) string {
+	return fmt.Sprintf("⚠️ *%s*\n\n_Expires in %s_", EscapeMarkdownV2(question), EscapeMarkdownV2(FormatDuration(timeout)))
+}
+
+// FormatMute confirms that alerts of a process are silenced
+func FormatMute(mute models.Mute, now time.Time) string {
+	what := fmt.Sprintf("`%s` on `%s`", EscapeMarkdownV2(mute.Process), EscapeMarkdownV2(mute.ServerURL))
+	if mute.UntilFixed() {
+		return fmt.Sprintf("🔇 Alerts for %s muted until it runs again", what)
+	}
+	return fmt.Sprintf("🔕 Alerts for %s snoozed for %s", what, EscapeMarkdownV2(FormatDuration(mute.Until.Sub(now))))
+}
+
+// FormatMutes lists the active mutes for /mutes
+func FormatMutes(mutes []models.Mute, now time.Time) string {
+	if len(mutes) == 0 {
+		return "*Active Mutes*\n\nNo alerts are muted\\."
+	}
+	var message strings.Builder
+	message.WriteString("*Active Mutes*\n\n")
+	for i, mute := range mutes {
+		until := "until it runs again"
+		if !mute.UntilFixed() {
+			until = "for " + FormatDuration(mute.Until.Sub(now))
+		}
+		message.WriteString(fmt.Sprintf("%d\\. `%s` on `%s`\n   %s, by %s\n",
+			i+1, EscapeMarkdownV2(mute.Process), EscapeMarkdownV2(mute.ServerURL), EscapeMarkdownV2(until), EscapeMarkdownV2(mute.By)))
+	}
+	return message.String()
+}
+
+// maxAuditResultLen cuts long errors, such as those of group actions listing
+// every failed process, so one entry can't fill a whole message
+const maxAuditResultLen = 300
+
+// FormatAuditEntry renders one audit log entry
+func FormatAuditEntry(entry audit.Entry) string {
+	result := "✅"
+	if entry.Result != "ok" {
+		text := entry.Result
+		if len(text) > maxAuditResultLen {
+			text = strings.ToValidUTF8(text[:maxAuditResultLen], "") + "…"
+		}
+		result = "❌ " + EscapeMarkdownV2(text)
+	}
+	action := EscapeMarkdownV2(entry.Action)
+	if entry.Target != "" {
+		action += fmt.Sprintf(" `%s`", EscapeMarkdownV2(entry.Target))
+	}
+	return fmt.Sprintf("`%s` %s \\(%d\\)\n%s on `%s` %s\n\n",
+		entry.Time.Format("2006-01-02 15:04:05"), EscapeMarkdownV2(entry.User), entry.UserID,
+		action, EscapeMarkdownV2(entry.Server), result)
+}
+
+// FormatAuditEntries lists a page of audit log entries, newest first. first
+// is the number of the first entry on the page counted from the newest, total
+// the number of matching entries.
+func FormatAuditEntries(entries []audit.Entry, query string, first, total int) string {
+	var message strings.Builder
+	message.WriteString("*Audit Log*")
+	if query != "" {
+		message.WriteString(fmt.Sprintf(" for `%s`", EscapeMarkdownV2(query)))
+	}
+	message.WriteString("\n")
+	if len(entries) == 0 {
+		message.WriteString("\nNo matching actions\\.")
+		return message.String()
+	}
+	message.WriteString(fmt.Sprintf("_Entries %d\\-%d of %d, newest first_\n\n", first, first+len(entries)-1, total))
+	for _, entry := range entries {
+		message.WriteString(FormatAuditEntry(entry))
+	}
+	return message.String()
+}
+
+// FormatDowntimeReport lists what changed on each server between the state
+// saved at savedAt and now
+func FormatDowntimeReport(savedAt, now time.Time, changes map[string][]state.Change, unreachable []string) string {
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("*Changes While the Bot Was Down*\n_Last state saved %s ago_\n",
+		EscapeMarkdownV2(FormatDuration(now.Sub(savedAt)))))
+
+	serverURLs := make([]string, 0, len(changes))
+	for serverURL := range changes {
+		serverURLs = append(serverURLs, serverURL)
+	}
+	sort.Strings(serverURLs)
+	for _, serverURL := range serverURLs {
+		message.WriteString(fmt.Sprintf("\n*Server:* `%s`\n", EscapeMarkdownV2(serverURL)))
+		for _, change := range changes[serverURL] {
+			process := EscapeMarkdownV2(change.Process)
+			switch {
+			case change.From == "":
+				message.WriteString(fmt.Sprintf("➕ `%s` added, `%s`\n", process, EscapeMarkdownV2(change.To)))
+			case change.To == "":
+				message.WriteString(fmt.Sprintf("➖ `%s` removed, was `%s`\n", process, EscapeMarkdownV2(change.From)))
+			default:
+				icon := "🔴"
+				if change.To == "RUNNING" {
+					icon = "🟢"
+				}
+				message.WriteString(fmt.Sprintf("%s `%s` `%s` → `%s`\n", icon, process, EscapeMarkdownV2(change.From), EscapeMarkdownV2(change.To)))
+			}
+		}
+	}
+	for _, serverURL := range unreachable {
+		message.WriteString(fmt.Sprintf("\n🔌 `%s` unreachable, changes will be alerted once it answers\n", EscapeMarkdownV2(serverURL)))
+	}
+	return message.String()
+}
@@ -0,0 +1,78 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 0, want: "0s"},
+		{d: 1400 * time.Millisecond, want: "1s"},
+		{d: 5*time.Minute + 3*time.Second, want: "5m 3s"},
+		{d: 2*time.Hour + 7*time.Minute + 59*time.Second, want: "2h 7m"},
+		{d: 75 * time.Hour, want: "3d 3h 0m"},
+	}
+	for _, tt := range tests {
+		if got := FormatDuration(tt.d); got != tt.want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRunInfo(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		process models.Process
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "running",
+			process: models.Process{State: "RUNNING", Start: now.Add(-3 * time.Hour), Now: now},
+			want:    []string{"*Uptime:* `3h 0m`"},
+			notWant: []string{"exit code", "Spawn error"},
+		},
+		{
+			name:    "exited",
+			process: models.Process{State: "EXITED", Start: now.Add(-time.Hour), Stop: now.Add(-50 * time.Minute), Now: now, ExitStatus: 3},
+			want:    []string{"*Ran for:* `10m 0s`", "*Last exit code:* `3`"},
+			notWant: []string{"Uptime"},
+		},
+		{
+			name:    "never started",
+			process: models.Process{State: "FATAL", SpawnErr: "can't find command 'web.py'", Now: now},
+			want:    []string{"*Spawn error:* `can't find command 'web\\.py'`"},
+			notWant: []string{"Uptime", "Ran for", "exit code"},
+		},
+	}
+	for _, tt := range tests {
+		got := formatRunInfo(tt.process)
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: run info %q lacks %q", tt.name, got, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(got, notWant) {
+				t.Errorf("%s: run info %q has %q", tt.name, got, notWant)
+			}
+		}
+	}
+
+	// Details cards and alerts both carry it
+	exited := tests[1].process
+	exited.Name = "web"
+	for _, message := range []string{FormatProcessDetails(exited), FormatProcessStatusChange(exited)} {
+		if !strings.Contains(message, "*Last exit code:* `3`") {
+			t.Errorf("message %q lacks the exit code", message)
+		}
+	}
+}
@@ -2,13 +2,12 @@ package telegram
 
 import (
 	"fmt"
-	"net/url"
+	"strconv"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/k0kubun/pp"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/config"
 	"github.com/rarebek/supervisor-tg-notifier/pkg/models"
-	"github.com/rarebek/supervisor-tg-notifier/pkg/utils"
+	"github.com/rarebek/supervisor-tg-notifier/pkg/permissions"
 )
 
 type PaginatedKeyboard struct {
@@ -17,25 +16,123 @@ type PaginatedKeyboard struct {
 	Keyboard    [][]tgbotapi.InlineKeyboardButton
 }
 
-func BuildProcessControlKeyboard(processName, serverURL string) tgbotapi.InlineKeyboardMarkup {
-	// Get short ID for server URL
-	shortID := utils.GetShortServerId(serverURL)
-	pp.Println("keyboard text is: ", "start_"+processName+"_"+shortID)
-	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
-				"🚀 Start",
-				fmt.Sprintf("start_%s_%s", processName, shortID),
+// BuildProcessControlKeyboard builds the buttons of a process details card.
+// role is the user's role on the process's group and serverRole the one on
+// the whole server, buttons they can't use are left out.
+func BuildProcessControlKeyboard(process models.Process, role, serverRole permissions.Role) tgbotapi.InlineKeyboardMarkup {
+	serverURL := process.ServerURL
+	// Control calls need the "group:name" form for grouped processes
+	processName := process.FullName()
+	group := process.Group
+	target := func(action string) Callback {
+		return Callback{Action: action, ServerURL: serverURL, Target: processName}
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	if role.Can(permissions.ActionControl) {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("🚀 Start", target("start")),
+			CallbackButton("🛑 Stop", target("stop")),
+			CallbackButton("🔄 Restart", target("restart")),
+		))
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if role.Can(permissions.ActionControl) {
+		row = append(row, CallbackButton("📶 Send HUP", target("signal")))
+	}
+	if role.Can(permissions.ActionView) {
+		row = append(row,
+			CallbackButton("📜 Logs", ProcessLogCallback(processName, serverURL, "out", -1, false)),
+			CallbackButton("⚙️ Config", target("config")),
+		)
+	}
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+
+	// Single-process programs live in a group of the same name, so group
+	// buttons are only useful when the group actually holds more
+	if group != "" && group != process.Name && role.Can(permissions.ActionControl) {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("🚀 Start group "+group, Callback{Action: "startgroup", ServerURL: serverURL, Target: group}),
+			CallbackButton("🛑 Stop group "+group, Callback{Action: "stopgroup", ServerURL: serverURL, Target: group}),
+		))
+	}
+
+	if serverRole.Can(permissions.ActionView) {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("🖥 Server controls", Callback{Action: "server", ServerURL: serverURL}),
+		))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// BuildServerControlKeyboard builds buttons acting on every process of one server
+func BuildServerControlKeyboard(serverURL string, role permissions.Role) tgbotapi.InlineKeyboardMarkup {
+	server := func(action string) Callback {
+		return Callback{Action: action, ServerURL: serverURL}
+	}
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	if role.Can(permissions.ActionControl) {
+		keyboard = append(keyboard,
+			tgbotapi.NewInlineKeyboardRow(
+				CallbackButton("🚀 Start all", server("startall")),
+				CallbackButton("🛑 Stop all", server("stopall")),
 			),
-			tgbotapi.NewInlineKeyboardButtonData(
-				"🛑 Stop",
-				fmt.Sprintf("stop_%s_%s", processName, shortID),
+			tgbotapi.NewInlineKeyboardRow(
+				CallbackButton("📶 Send HUP to all", server("signalall")),
 			),
+		)
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		CallbackButton("📜 Daemon log", DaemonLogCallback(serverURL, 0, false)),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// BuildProcessLogKeyboard builds paging buttons for a log view. olderEnd is
+// where the older page ends and newerStart where the newer page starts, 0
+// and -1 respectively hide the button.
+func BuildProcessLogKeyboard(processName, serverURL, stream string, olderEnd, newerStart int64) tgbotapi.InlineKeyboardMarkup {
+	logData := func(stream string, offset int64, after bool) Callback {
+		return ProcessLogCallback(processName, serverURL, stream, offset, after)
+	}
+
+	var navRow []tgbotapi.InlineKeyboardButton
+	if olderEnd > 0 {
+		navRow = append(navRow, CallbackButton("⬅️ Older", logData(stream, olderEnd, false)))
+	}
+	if newerStart >= 0 {
+		navRow = append(navRow, CallbackButton("Newer ➡️", logData(stream, newerStart, true)))
+	}
+
+	otherStream, otherLabel := "err", "📕 stderr"
+	if stream == "err" {
+		otherStream, otherLabel = "out", "📗 stdout"
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	if len(navRow) > 0 {
+		keyboard = append(keyboard, navRow)
+	}
+	keyboard = append(keyboard,
+		tgbotapi.NewInlineKeyboardRow(
+			CallbackButton(otherLabel, logData(otherStream, -1, false)),
+			CallbackButton("🔄 Latest", logData(stream, -1, false)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("🔙 Details", DetailsCallback(processName, serverURL)),
 		),
 	)
+
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
 }
 
-func BuildPaginatedKeyboard(processes []models.Process, page int) tgbotapi.InlineKeyboardMarkup {
+// BuildPaginatedKeyboard links each process on a page to its details card.
+// pageCallback builds the callbacks of the previous and next page buttons.
+func BuildPaginatedKeyboard(processes []models.Process, page int, pageCallback func(page int) Callback) tgbotapi.InlineKeyboardMarkup {
 	totalProcesses := len(processes)
 	totalPages := (totalProcesses + config.ProcessesPerPage - 1) / config.ProcessesPerPage
 
@@ -49,18 +146,18 @@ func BuildPaginatedKeyboard(processes []models.Process, page int) tgbotapi.Inlin
 
 	for i := start; i < end; i++ {
 		process := processes[i]
-		buttonLabel := fmt.Sprintf("🔍 %s", EscapeMarkdownV2(process.Name))
+		buttonLabel := fmt.Sprintf("🔍 %s", process.FullName())
 		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(buttonLabel, fmt.Sprintf("details_%s_%s", process.Name, url.QueryEscape(process.ServerURL))),
+			CallbackButton(buttonLabel, DetailsCallback(process.FullName(), process.ServerURL)),
 		))
 	}
 
 	navRow := []tgbotapi.InlineKeyboardButton{}
 	if page > 1 {
-		navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("⬅️ Previous Page", fmt.Sprintf("page_%d", page-1)))
+		navRow = append(navRow, CallbackButton("⬅️ Previous Page", pageCallback(page-1)))
 	}
 	if page < totalPages {
-		navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("Next Page ➡️", fmt.Sprintf("page_%d", page+1)))
+		navRow = append(navRow, CallbackButton("Next Page ➡️", pageCallback(page+1)))
 	}
 	if len(navRow) > 0 {
 		keyboard = append(keyboard, navRow)
@@ -69,92 +166,268 @@ func BuildPaginatedKeyboard(processes []models.Process, page int) tgbotapi.Inlin
 	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: keyboard}
 }
 
-func BuildAllProcessesKeyboard(processes []models.Process) tgbotapi.InlineKeyboardMarkup {
+// BuildAllProcessesKeyboard links each process to its details card, two per
+// row, with start and stop buttons where roleOf allows controlling it
+func BuildAllProcessesKeyboard(processes []models.Process, roleOf func(models.Process) permissions.Role) tgbotapi.InlineKeyboardMarkup {
 	var keyboard [][]tgbotapi.InlineKeyboardButton
 
-	for i := 0; i < len(processes); i += 2 {
-		var row []tgbotapi.InlineKeyboardButton
-
-		process := processes[i]
-		row = append(row,
-			tgbotapi.NewInlineKeyboardButtonData(
-				"🔍 "+EscapeMarkdownV2(process.Name),
-				fmt.Sprintf("details_%s_%s", process.Name, url.QueryEscape(process.ServerURL)),
-			),
-			tgbotapi.NewInlineKeyboardButtonData(
-				"🚀",
-				fmt.Sprintf("start_%s_%s", process.Name, url.QueryEscape(process.ServerURL)),
-			),
-			tgbotapi.NewInlineKeyboardButtonData(
-				"🛑",
-				fmt.Sprintf("stop_%s_%s", process.Name, url.QueryEscape(process.ServerURL)),
-			),
-		)
-
-		if i+1 < len(processes) {
-			process = processes[i+1]
+	buttons := func(process models.Process) []tgbotapi.InlineKeyboardButton {
+		target := func(action string) Callback {
+			return Callback{Action: action, ServerURL: process.ServerURL, Target: process.FullName()}
+		}
+		row := []tgbotapi.InlineKeyboardButton{
+			CallbackButton("🔍 "+EscapeMarkdownV2(process.Name), target("details")),
+		}
+		if roleOf(process).Can(permissions.ActionControl) {
 			row = append(row,
-				tgbotapi.NewInlineKeyboardButtonData(
-					"🔍 "+EscapeMarkdownV2(process.Name),
-					fmt.Sprintf("details_%s_%s", process.Name, url.QueryEscape(process.ServerURL)),
-				),
-				tgbotapi.NewInlineKeyboardButtonData(
-					"🚀",
-					fmt.Sprintf("start_%s_%s", process.Name, url.QueryEscape(process.ServerURL)),
-				),
-				tgbotapi.NewInlineKeyboardButtonData(
-					"🛑",
-					fmt.Sprintf("stop_%s_%s", process.Name, url.QueryEscape(process.ServerURL)),
-				),
+				CallbackButton("🚀", target("start")),
+				CallbackButton("🛑", target("stop")),
 			)
 		}
+		return row
+	}
 
+	for i := 0; i < len(processes); i += 2 {
+		row := buttons(processes[i])
+		if i+1 < len(processes) {
+			row = append(row, buttons(processes[i+1])...)
+		}
 		keyboard = append(keyboard, row)
 	}
 
 	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("📋 Paginated View", "page_1"),
-		tgbotapi.NewInlineKeyboardButtonData("🔄 Refresh", "show_all"),
+		CallbackButton("📋 Paginated View", FindCallback("", 1)),
+		CallbackButton("🔄 Refresh", Callback{Action: "show_all"}),
 	))
 
 	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
 }
 
-func ShowAllProcessKeyboard(processes []models.Process) tgbotapi.InlineKeyboardMarkup {
+// ShowAllProcessKeyboard has start and stop buttons for each process roleOf
+// allows controlling
+func ShowAllProcessKeyboard(processes []models.Process, roleOf func(models.Process) permissions.Role) tgbotapi.InlineKeyboardMarkup {
 	var keyboard [][]tgbotapi.InlineKeyboardButton
 
 	for _, process := range processes {
-		// Get short ID for server URL
-		shortID := utils.GetShortServerId(process.ServerURL)
-
+		if !roleOf(process).Can(permissions.ActionControl) {
+			continue
+		}
 		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
+			CallbackButton(
 				fmt.Sprintf("🚀 %s", EscapeMarkdownV2(process.Name)),
-				fmt.Sprintf("start_%s_%s", process.Name, shortID), // Add server shortID
+				Callback{Action: "start", ServerURL: process.ServerURL, Target: process.FullName()},
 			),
-			tgbotapi.NewInlineKeyboardButtonData(
+			CallbackButton(
 				fmt.Sprintf("🛑 %s", EscapeMarkdownV2(process.Name)),
-				fmt.Sprintf("stop_%s_%s", process.Name, shortID), // Add server shortID
+				Callback{Action: "stop", ServerURL: process.ServerURL, Target: process.FullName()},
 			),
 		))
 	}
 
 	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("📋 Paginated View", "page_1"),
-		tgbotapi.NewInlineKeyboardButtonData("🔄 Refresh", "show_all"),
+		CallbackButton("📋 Paginated View", FindCallback("", 1)),
+		CallbackButton("🔄 Refresh", Callback{Action: "show_all"}),
 	))
 
 	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
 }
 
-func ChooseProcessesKeyboard(processes []models.Process) tgbotapi.InlineKeyboardMarkup {
-	var keyboard [][]tgbotapi.InlineKeyboardButton
+// SubscriptionItem is a server, group or process a user can subscribe to.
+// Target is empty for a whole server.
+type SubscriptionItem struct {
+	Label     string
+	ServerURL string
+	Target    string
+	Chosen    bool
+}
 
-	for _, process := range processes {
+// SubscriptionsPerPage keeps the process subscription keyboard short
+const SubscriptionsPerPage = 10
+
+func subscriptionToggle(item SubscriptionItem, page int) tgbotapi.InlineKeyboardButton {
+	icon := "⬜"
+	if item.Chosen {
+		icon = "✅"
+	}
+	return CallbackButton(icon+" "+item.Label, Callback{Action: "sub", ServerURL: item.ServerURL, Target: item.Target, Args: []string{strconv.Itoa(page)}})
+}
+
+// ChooseServersKeyboard toggles subscriptions to whole servers and opens the
+// groups and processes of each
+func ChooseServersKeyboard(servers []SubscriptionItem) tgbotapi.InlineKeyboardMarkup {
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, server := range servers {
 		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(process.Name, process.Name),
+			subscriptionToggle(server, 0),
+			CallbackButton("📂 Processes", Callback{Action: "subs", ServerURL: server.ServerURL, Args: []string{"1"}}),
 		))
 	}
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// ChooseProcessesKeyboard toggles subscriptions to the groups and processes
+// of one server, a page at a time
+func ChooseProcessesKeyboard(serverURL string, items []SubscriptionItem, page int) tgbotapi.InlineKeyboardMarkup {
+	totalPages := (len(items) + SubscriptionsPerPage - 1) / SubscriptionsPerPage
+	start := (page - 1) * SubscriptionsPerPage
+	end := min(start+SubscriptionsPerPage, len(items))
 
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, item := range items[start:end] {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(subscriptionToggle(item, page)))
+	}
+
+	pageData := func(page int) Callback {
+		return Callback{Action: "subs", ServerURL: serverURL, Args: []string{strconv.Itoa(page)}}
+	}
+	navRow := []tgbotapi.InlineKeyboardButton{}
+	if page > 1 {
+		navRow = append(navRow, CallbackButton("⬅️ Previous Page", pageData(page-1)))
+	}
+	if page < totalPages {
+		navRow = append(navRow, CallbackButton("Next Page ➡️", pageData(page+1)))
+	}
+	if len(navRow) > 0 {
+		keyboard = append(keyboard, navRow)
+	}
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		CallbackButton("🔙 Servers", Callback{Action: "subs"}),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// BuildConfigReloadKeyboard offers to apply reread changes per server and,
+// when several servers have changes, on all of them at once
+func BuildConfigReloadKeyboard(serverURLs []string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, serverURL := range serverURLs {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("✅ Apply on "+serverURL, Callback{Action: "reload", ServerURL: serverURL}),
+		))
+	}
+	if len(serverURLs) > 1 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("✅ Apply on all servers", Callback{Action: "reload"}),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// BuildDaemonLogKeyboard pages through the supervisord main log. olderBack is
+// where the older page ends and newerBack where the newer page starts, both
+// counted back from the end of the log, -1 hides the button.
+func BuildDaemonLogKeyboard(serverURL string, olderBack, newerBack int64, canClear bool) tgbotapi.InlineKeyboardMarkup {
+	var navRow []tgbotapi.InlineKeyboardButton
+	if olderBack >= 0 {
+		navRow = append(navRow, CallbackButton("⬅️ Older", DaemonLogCallback(serverURL, olderBack, false)))
+	}
+	if newerBack >= 0 {
+		navRow = append(navRow, CallbackButton("Newer ➡️", DaemonLogCallback(serverURL, newerBack, true)))
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	if len(navRow) > 0 {
+		keyboard = append(keyboard, navRow)
+	}
+	actionRow := tgbotapi.NewInlineKeyboardRow(
+		CallbackButton("🔄 Latest", DaemonLogCallback(serverURL, 0, false)),
+	)
+	if canClear {
+		actionRow = append(actionRow, CallbackButton("🗑 Clear", Callback{Action: "dlogclear", ServerURL: serverURL}))
+	}
+	keyboard = append(keyboard,
+		actionRow,
+		tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("🔙 Server controls", Callback{Action: "server", ServerURL: serverURL}),
+		),
+	)
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// BuildAuditKeyboard pages through /audit results. olderEnd is where the
+// older page ends and newerStart where the newer page starts, -1 hides the
+// button.
+func BuildAuditKeyboard(query string, olderEnd, newerStart int) tgbotapi.InlineKeyboardMarkup {
+	// Never nil, an empty list removes the buttons of an edited message
+	navRow := []tgbotapi.InlineKeyboardButton{}
+	if olderEnd >= 0 {
+		navRow = append(navRow, CallbackButton("⬅️ Older", AuditCallback(query, olderEnd, false)))
+	}
+	if newerStart >= 0 {
+		navRow = append(navRow, CallbackButton("Newer ➡️", AuditCallback(query, newerStart, true)))
+	}
+	keyboard := [][]tgbotapi.InlineKeyboardButton{}
+	if len(navRow) > 0 {
+		keyboard = append(keyboard, navRow)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+func BuildDaemonLogClearKeyboard(serverURL string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("🗑 Yes, clear", Callback{Action: "dlogclearok", ServerURL: serverURL}),
+			CallbackButton("✖️ Cancel", DaemonLogCallback(serverURL, 0, false)),
+		),
+	)
+}
+
+func BuildProcessConfigKeyboard(processName, serverURL string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("🔙 Details", DetailsCallback(processName, serverURL)),
+		),
+	)
+}
+
+func BuildConfirmationKeyboard(token string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			CallbackButton("✅ Confirm", Callback{Action: "confirm", Target: token}),
+			CallbackButton("❌ Cancel", Callback{Action: "cancel", Target: token}),
+		),
+	)
+}
+
+// BuildAlertKeyboard offers to start or stop an alerted process and to
+// silence its further alerts. role is the recipient's role on the process's
+// group, buttons they can't use are left out.
+func BuildAlertKeyboard(serverURL, processName string, role permissions.Role) tgbotapi.InlineKeyboardMarkup {
+	target := func(action string, args ...string) Callback {
+		return Callback{Action: action, ServerURL: serverURL, Target: processName, Args: args}
+	}
+	// Never nil, alerts to viewers go without buttons
+	keyboard := [][]tgbotapi.InlineKeyboardButton{}
+	// Muting silences the alert for everyone, it takes the same role as
+	// stopping the process
+	if role.Can(permissions.ActionControl) {
+		keyboard = append(keyboard,
+			tgbotapi.NewInlineKeyboardRow(
+				CallbackButton("🚀 Start", target("start")),
+				CallbackButton("🛑 Stop", target("stop")),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				CallbackButton("🔕 Snooze 1h", target("mute", "1h")),
+				CallbackButton("🔕 8h", target("mute", "8h")),
+				CallbackButton("🔕 24h", target("mute", "24h")),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				CallbackButton("🔇 Mute until fixed", target("mute", "fixed")),
+			),
+		)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// BuildMutesKeyboard has a button lifting each active mute, numbered like
+// in FormatMutes
+func BuildMutesKeyboard(mutes []models.Mute) tgbotapi.InlineKeyboardMarkup {
+	// Never nil, an empty list removes the buttons of an edited message
+	keyboard := [][]tgbotapi.InlineKeyboardButton{}
+	for i, mute := range mutes {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			CallbackButton(fmt.Sprintf("🔔 Unmute #%d %s", i+1, mute.Process), Callback{Action: "unmute", ServerURL: mute.ServerURL, Target: mute.Process}),
+		))
+	}
 	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
 }
@@ -20,8 +20,13 @@ func SendToTelegram(bot *tgbotapi.BotAPI, chatID int64, message string) error {
 }
 
 func SendStatusMessage(bot *tgbotapi.BotAPI, chatID int64, processName, action string) error {
-	escapedName := EscapeMarkdownV2(processName)
-	message := fmt.Sprintf("*Process* `%s` *%s successfully\\.*", escapedName, action)
+	return SendTargetStatusMessage(bot, chatID, "Process", processName, action)
+}
+
+// SendTargetStatusMessage reports a successful action on a process, group or server
+func SendTargetStatusMessage(bot *tgbotapi.BotAPI, chatID int64, kind, name, action string) error {
+	escapedName := EscapeMarkdownV2(name)
+	message := fmt.Sprintf("*%s* `%s` *%s successfully\\.*", kind, escapedName, action)
 	return SendToTelegram(bot, chatID, message)
 }
 
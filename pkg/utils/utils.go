@@ -11,6 +11,10 @@ func GetShortServerId(serverURL string) string {
 	parts := strings.Split(serverURL, "://")
 	if len(parts) > 1 {
 		hostPort := strings.Split(parts[1], "/")[0]
+		if hostPort == "" {
+			// unix:///path/to.sock has no host, the socket path identifies it
+			hostPort = parts[1]
+		}
 		hash := fmt.Sprintf("%x", md5.Sum([]byte(hostPort)))
 		return hash[:8]
 	}